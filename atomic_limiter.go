@@ -0,0 +1,215 @@
+package ratelimiter
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	atomicCountBits = 20
+	atomicIndexBits = 64 - 2*atomicCountBits
+
+	atomicCountMask = 1<<atomicCountBits - 1
+	atomicIndexMask = 1<<atomicIndexBits - 1
+
+	// AtomicMaxLimit is the largest limit supported by AtomicLimiter.
+	AtomicMaxLimit = atomicCountMask
+)
+
+// AtomicLimiter is a lock-free SyncLimiter, the index of the current window along with the
+// counts of the current and previous windows are packed into a single word which is updated
+// with compare-and-swap, so concurrent callers never block each other. The limit can't be
+// more than AtomicMaxLimit.
+type AtomicLimiter struct {
+	// state and index are accessed atomically, they are kept first to be 64-bit aligned on 32-bit platforms.
+	state uint64
+	// index is the full index of the window of the state, which only keeps it modulo
+	// 2^atomicIndexBits. It is recorded after the state is updated, so it may briefly lag behind.
+	index    uint64
+	killed   int32
+	origin   time.Time
+	size     time.Duration
+	limit    uint64
+	clock    Clock
+	notifier notifier
+}
+
+// packState packs the index of the current window along with the counts of the previous and
+// current windows, the index is kept modulo 2^atomicIndexBits.
+func packState(index, previous, current uint64) uint64 {
+	return (index&atomicIndexMask)<<(2*atomicCountBits) | previous<<atomicCountBits | current
+}
+
+func unpackState(state uint64) (uint64, uint64, uint64) {
+	return state >> (2 * atomicCountBits), state >> atomicCountBits & atomicCountMask, state & atomicCountMask
+}
+
+// load returns the state along with the full index of it's window, which is the first index
+// at or after the last recorded one matching the index kept in the state. The recorded index is
+// loaded first, so that it is never ahead of the state.
+func (a *AtomicLimiter) load() (uint64, uint64) {
+	recorded := atomic.LoadUint64(&a.index)
+	state := atomic.LoadUint64(&a.state)
+
+	index, _, _ := unpackState(state)
+	return state, recorded + (index-recorded)&atomicIndexMask
+}
+
+// record stores the full index of the window of the state after it was updated.
+func (a *AtomicLimiter) record(index uint64) {
+	for {
+		recorded := atomic.LoadUint64(&a.index)
+		if recorded >= index || atomic.CompareAndSwapUint64(&a.index, recorded, index) {
+			return
+		}
+	}
+}
+
+// windowsAt returns the index of the window containing now along with the counts of the previous and
+// current windows as they would be after sliding them to now, and the time elapsed in the window.
+func (a *AtomicLimiter) windowsAt(state, index uint64, now time.Time) (uint64, uint64, uint64, time.Duration) {
+	_, previous, current := unpackState(state)
+
+	elapsed := now.Sub(a.origin)
+	if elapsed < 0 {
+		elapsed = 0
+	}
+
+	nowIndex := uint64(elapsed / a.size)
+	switch {
+	case nowIndex < index:
+		// the window was slided by a caller that read the clock later, count in it's window.
+		return index, previous, current, 0
+	case nowIndex == index:
+	case nowIndex == index+1:
+		previous, current = current, 0
+	default:
+		previous, current = 0, 0
+	}
+
+	return nowIndex, previous, current, elapsed % a.size
+}
+
+// admits reports whether n tasks can be counted at now, along with the state after counting them
+// and the full index of it's window.
+func (a *AtomicLimiter) admits(state, index uint64, now time.Time, n uint64) (bool, uint64, uint64) {
+	index, previous, current, elapsed := a.windowsAt(state, index, now)
+
+	w := float64(a.size-elapsed) / float64(a.size)
+	if uint64(w*float64(previous))+current+n > a.limit {
+		return false, state, index
+	}
+
+	return true, packState(index, previous, current+n), index
+}
+
+// ShouldAllow makes decison whether n tasks can be allowed or not.
+//
+// Parameters:
+//
+// 1. n: number of tasks to be processed, set this as 1 for a single task. (Example: An HTTP request)
+//
+// Returns (bool, error). (false, error) if limiter is inactive (or it is killed). Otherwise,
+// (true/false, nil) depending on whether n tasks can be allowed or not.
+func (a *AtomicLimiter) ShouldAllow(n uint64) (bool, error) {
+	if atomic.LoadInt32(&a.killed) == 1 {
+		return false, fmt.Errorf("function ShouldAllow called on an inactive instance: %w", ErrLimiterKilled)
+	}
+
+	if n > a.limit {
+		a.notifier.notify(n, false)
+		return false, nil
+	}
+
+	for {
+		state, index := a.load()
+
+		allowed, newState, newIndex := a.admits(state, index, a.clock.Now(), n)
+		if !allowed {
+			a.notifier.notify(n, false)
+			return false, nil
+		}
+
+		if atomic.CompareAndSwapUint64(&a.state, state, newState) {
+			if newIndex != index {
+				a.record(newIndex)
+			}
+			a.notifier.notify(n, true)
+			return true, nil
+		}
+	}
+}
+
+// Peek reports whether n tasks would be allowed right now, without counting them.
+//
+// Parameters:
+//
+// 1. n: number of tasks to be processed, set this as 1 for a single task. (Example: An HTTP request)
+//
+// Returns (bool, error). (false, error) if limiter is inactive (or it is killed). Otherwise,
+// (true/false, nil) depending on whether n tasks would be allowed or not.
+func (a *AtomicLimiter) Peek(n uint64) (bool, error) {
+	if atomic.LoadInt32(&a.killed) == 1 {
+		return false, fmt.Errorf("function Peek called on an inactive instance: %w", ErrLimiterKilled)
+	}
+
+	if n > a.limit {
+		return false, nil
+	}
+
+	state, index := a.load()
+	allowed, _, _ := a.admits(state, index, a.clock.Now(), n)
+	return allowed, nil
+}
+
+// inspect describes the state of the limiter.
+func (a *AtomicLimiter) inspect() KeyInfo {
+	state, index := a.load()
+	_, previous, current, elapsed := a.windowsAt(state, index, a.clock.Now())
+	w := float64(a.size-elapsed) / float64(a.size)
+
+	return KeyInfo{
+		Limit:    a.limit,
+		Size:     a.size,
+		Current:  current,
+		Previous: previous,
+		Usage:    uint64(w*float64(previous)) + current,
+	}
+}
+
+// Kill the limiter, returns error if the limiter has been killed already.
+func (a *AtomicLimiter) Kill() error {
+	if !atomic.CompareAndSwapInt32(&a.killed, 0, 1) {
+		return fmt.Errorf("called Kill on already killed limiter: %w", ErrLimiterKilled)
+	}
+
+	return nil
+}
+
+// NewAtomicLimiter creates an instance of AtomicLimiter and returns it's pointer.
+//
+// Parameters:
+//
+// 1. limit: The number of tasks to be allowd, at most AtomicMaxLimit
+//
+// 2. size: duration
+//
+// 3. opts: optional parameters, example: WithClock, WithName, WithObserver
+//
+// Returns an error if limit is 0 or more than AtomicMaxLimit, or size is less than a millisecond.
+func NewAtomicLimiter(limit uint64, size time.Duration, opts ...Option) (*AtomicLimiter, error) {
+	if limit == 0 || limit > AtomicMaxLimit || size < time.Millisecond {
+		return nil, ErrInvalidConfig
+	}
+
+	o := newOptions(opts)
+
+	return &AtomicLimiter{
+		origin:   o.clock.Now().Truncate(size),
+		size:     size,
+		limit:    limit,
+		clock:    o.clock,
+		notifier: o.notifier(),
+	}, nil
+}
@@ -0,0 +1,151 @@
+package ratelimiter
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestAtomicLimiterMatchesSyncLimiter(t *testing.T) {
+	clock := NewManualClock(time.Unix(1000, 0))
+	atomicLimiter, _ := NewAtomicLimiter(10, time.Second, WithClock(clock))
+	syncLimiter, _ := NewSyncLimiter(10, time.Second, WithClock(clock))
+
+	steps := []struct {
+		advance time.Duration
+		n       uint64
+	}{
+		{0, 4}, {0, 6}, {0, 1},
+		{1200 * time.Millisecond, 3}, {0, 2},
+		{300 * time.Millisecond, 5}, {0, 1},
+		{700 * time.Millisecond, 4}, {0, 4},
+		{5 * time.Second, 10}, {0, 1},
+		{999 * time.Millisecond, 1}, {2 * time.Millisecond, 2},
+	}
+
+	for idx, step := range steps {
+		clock.Advance(step.advance)
+
+		expected, _ := syncLimiter.ShouldAllow(step.n)
+		if allowed, _ := atomicLimiter.Peek(step.n); allowed != expected {
+			t.Fatalf("step %d: Peek(%d) returned %v, expected %v", idx, step.n, allowed, expected)
+		}
+
+		allowed, err := atomicLimiter.ShouldAllow(step.n)
+		if err != nil {
+			t.Fatalf("Error when calling ShouldAllow() on active limiter, Error: %v", err)
+		}
+		if allowed != expected {
+			t.Fatalf("step %d: ShouldAllow(%d) returned %v, expected %v", idx, step.n, allowed, expected)
+		}
+	}
+
+	atomicLimiter.Kill()
+	if _, err := atomicLimiter.ShouldAllow(1); err == nil {
+		t.Fatalf("Calling ShouldAllow() on inactive limiter did not throw any errors.")
+	}
+
+	if err := atomicLimiter.Kill(); err == nil {
+		t.Fatalf("Calling Kill() on inactive limiter did not throw any errors.")
+	}
+}
+
+func TestAtomicLimiterConcurrent(t *testing.T) {
+	clock := NewManualClock(time.Unix(1000, 0))
+	limiter, _ := NewAtomicLimiter(1000, time.Second, WithClock(clock))
+
+	var allowed int64
+	wg := sync.WaitGroup{}
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 500; j++ {
+				if ok, _ := limiter.ShouldAllow(1); ok {
+					atomic.AddInt64(&allowed, 1)
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+	if allowed != 1000 {
+		t.Fatalf("%d tasks were allowed by concurrent callers, expected 1000", allowed)
+	}
+}
+
+func TestAtomicLimiterLongIdle(t *testing.T) {
+	clock := NewManualClock(time.Unix(1000, 0))
+	limiter, _ := NewAtomicLimiter(10, time.Millisecond, WithClock(clock))
+
+	// the index kept in the state wraps around after 2^24 windows, the counts must not be reused:
+	for _, idle := range []time.Duration{1<<23 + 5, 1 << 24, 1<<24 + 1, 1<<24 - 1, 3 << 24} {
+		if allowed, _ := limiter.ShouldAllow(10); !allowed {
+			t.Fatalf("ShouldAllow(10) was not allowed before idling for %d windows", idle)
+		}
+
+		clock.Advance(idle * time.Millisecond)
+		if allowed, _ := limiter.Peek(1); !allowed {
+			t.Fatalf("Peek(1) was not allowed after idling for %d windows", idle)
+		}
+
+		if allowed, _ := limiter.ShouldAllow(1); !allowed {
+			t.Fatalf("ShouldAllow(1) was not allowed after idling for %d windows", idle)
+		}
+
+		// start the next period from an empty window.
+		clock.Advance(2 * time.Millisecond)
+	}
+}
+
+func TestAtomicLimiterInvalidConfiguration(t *testing.T) {
+	if _, err := NewAtomicLimiter(AtomicMaxLimit+1, time.Second); err == nil {
+		t.Fatalf("NewAtomicLimiter() did not return error for limit beyond AtomicMaxLimit")
+	}
+
+	if _, err := NewAtomicLimiter(0, time.Second); err == nil {
+		t.Fatalf("NewAtomicLimiter() did not return error for limit 0")
+	}
+
+	if _, err := NewAtomicLimiter(10, time.Microsecond); err == nil {
+		t.Fatalf("NewAtomicLimiter() did not return error for size less than a millisecond")
+	}
+}
+
+// benchmarkConcurrentLimiter runs ShouldAllow from parallel goroutines with GOMAXPROCS 1 to 64.
+func benchmarkConcurrentLimiter(b *testing.B, newLimiter func() Limiter) {
+	for procs := 1; procs <= 64; procs *= 2 {
+		b.Run(fmt.Sprintf("GOMAXPROCS=%d", procs), func(b *testing.B) {
+			defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(procs))
+
+			limiter := newLimiter()
+			defer limiter.Kill()
+
+			b.RunParallel(func(p *testing.PB) {
+				for p.Next() {
+					_, err := limiter.ShouldAllow(1)
+					if err != nil {
+						b.Fatalf("Error when calling ShouldAllow() on active limiter, Error: %v", err)
+					}
+				}
+			})
+		})
+	}
+}
+
+func BenchmarkConcurrentAtomicLimiter(b *testing.B) {
+	benchmarkConcurrentLimiter(b, func() Limiter {
+		limiter, _ := NewAtomicLimiter(AtomicMaxLimit, time.Second)
+		return limiter
+	})
+}
+
+func BenchmarkConcurrentMutexSyncLimiter(b *testing.B) {
+	benchmarkConcurrentLimiter(b, func() Limiter {
+		limiter, _ := NewSyncLimiter(AtomicMaxLimit, time.Second)
+		return limiter
+	})
+}
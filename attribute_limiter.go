@@ -1,20 +1,223 @@
 package ratelimiter
 
 import (
+	"container/list"
+	"context"
+	"errors"
 	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
+// resultLimiter is implemented by limiters that can describe their decisions.
+type resultLimiter interface {
+	Allow(n uint64) (Result, error)
+}
+
+// peeker is implemented by limiters that can tell whether tasks would be allowed without counting them.
+type peeker interface {
+	Peek(n uint64) (bool, error)
+}
+
+// consumer is implemented by limiters that can count tasks beyond the limit.
+type consumer interface {
+	Consume(n uint64) (uint64, error)
+}
+
+// configurableLimiter is implemented by limiters that can be reconfigured at runtime.
+type configurableLimiter interface {
+	SetLimit(limit uint64) error
+	SetSize(size time.Duration) error
+}
+
+// returner is implemented by limiters that give back tasks to the window they were counted in.
+type returner interface {
+	Return(n uint64, chargedAt time.Time)
+}
+
+// windowConfigurer is implemented by limiters whose limit and size are only valid together,
+// they are changed at once so that a rejected configuration leaves both unchanged.
+type windowConfigurer interface {
+	configure(limit uint64, size time.Duration) error
+}
+
+// LimiterType selects the algorithm of the limiters created by AttributeBasedLimiter.
+type LimiterType int
+
+const (
+	// SlidingWindow uses DefaultLimiter or SyncLimiter depending on backgroundSliding.
+	SlidingWindow LimiterType = iota
+	// TokenBucket uses TokenBucketLimiter, with burst equal to the limit.
+	TokenBucket
+	// GCRA uses GCRALimiter, with burst equal to the limit.
+	GCRA
+	// SlidingLog uses SlidingLogLimiter.
+	SlidingLog
+	// FixedWindow uses FixedWindowLimiter.
+	FixedWindow
+)
+
+// SaturationPolicy selects what AttributeBasedLimiter does with new keys once it holds MaxKeys keys.
+type SaturationPolicy int
+
+const (
+	// EvictColdest evicts the least recently used key to make room for the new key.
+	EvictColdest SaturationPolicy = iota
+	// RejectNewKeys refuses to create the new key, the tasks of keys that could not be
+	// created are not allowed by MustShouldAllow.
+	RejectNewKeys
+	// UseOverflowLimiter refuses to create the new key, MustShouldAllow counts the tasks of keys
+	// that could not be created on the limiter set by WithOverflowLimiter. Without an overflow
+	// limiter it falls back to RejectNewKeys, the tasks of those keys are not allowed.
+	UseOverflowLimiter
+)
+
+// LimiterFactory creates the limiter of a key of an AttributeBasedLimiter, with the limit and size
+// passed to CreateNewKey, MustShouldAllow etc. It can return any Limiter implementation, example:
+// a different limiter type depending on the key. Returning a nil limiter without an error is
+// reported as ErrInvalidConfig. The factory is called without the keys locked, so it can use the keys
+// of the AttributeBasedLimiter, but it must not change it's policies. If the key is created by another
+// caller meanwhile, the limiter returned by the factory is killed.
+type LimiterFactory func(key string, limit uint64, size time.Duration) (Limiter, error)
+
 // AttributeMap is a custom map type of string key and Limiter instance as value
 type AttributeMap map[string]Limiter
 
+// attributeEntry is the limiter of a key along with the time it was last used at.
+type attributeEntry struct {
+	// lastUsed is accessed atomically, it is kept first to be 64-bit aligned on 32-bit platforms.
+	lastUsed   int64
+	referenced int32
+	limiter    Limiter
+	size       time.Duration
+	element    *list.Element
+	policy     string
+}
+
+// touch records that the key was used at now.
+func (e *attributeEntry) touch(now time.Time) {
+	atomic.StoreInt64(&e.lastUsed, now.UnixNano())
+}
+
+// idle reports whether the windows of the key have been empty for ttl at now, i.e the
+// key was not used for two window sizes (the windows it was counted in) plus ttl.
+func (e *attributeEntry) idle(now time.Time, ttl time.Duration) bool {
+	return now.UnixNano()-atomic.LoadInt64(&e.lastUsed) >= int64(2*e.size+ttl)
+}
+
+// reference marks the key as recently used, so that it is skipped once by the eviction.
+func (e *attributeEntry) reference() {
+	if atomic.LoadInt32(&e.referenced) == 0 {
+		atomic.StoreInt32(&e.referenced, 1)
+	}
+}
+
+// attributeShard holds the limiters of the keys hashed to it, the limiters synchronize
+// themselves, so the shard is locked only to look them up.
+//
+// When the number of keys is bounded, the keys are kept in a ring swept by a clock hand to
+// evict the least recently used key (the CLOCK approximation of LRU), which unlike a strict
+// LRU list does not have to be reordered, and thus write-locked, on every lookup.
+type attributeShard struct {
+	entries        map[string]*attributeEntry
+	concurrencyMap map[string]*ConcurrencyLimiter
+	m              sync.RWMutex
+	// keys is the number of keys of all the shards, it is only counted when the number of keys is bounded.
+	keys *int64
+	ring *list.List
+	hand *list.Element
+}
+
+// add the entry of the key, must be called with lock held. The key must have been counted
+// by the caller when the number of keys is bounded.
+func (s *attributeShard) add(key string, entry *attributeEntry) {
+	if s.keys != nil {
+		// new keys are placed right behind the hand, so that they are swept last.
+		entry.referenced = 1
+		if s.hand != nil {
+			entry.element = s.ring.InsertBefore(key, s.hand)
+		} else {
+			entry.element = s.ring.PushBack(key)
+		}
+	}
+
+	s.entries[key] = entry
+}
+
+// remove the entry of the key, must be called with lock held.
+func (s *attributeShard) remove(key string, entry *attributeEntry) {
+	if entry.element != nil {
+		if s.hand == entry.element {
+			s.hand = s.hand.Next()
+		}
+		s.ring.Remove(entry.element)
+	}
+
+	if s.keys != nil {
+		atomic.AddInt64(s.keys, -1)
+	}
+
+	delete(s.entries, key)
+}
+
+// evictColdest removes the least recently used key, the keys used since the last sweep are given a
+// second chance. The limiter of the key is not killed, as callers might still hold it, unless it slides
+// it's windows in the background. Must be called with lock held on a shard having keys.
+func (s *attributeShard) evictColdest() {
+	for {
+		if s.hand == nil {
+			s.hand = s.ring.Front()
+		}
+
+		key := s.hand.Value.(string)
+		entry := s.entries[key]
+		if atomic.CompareAndSwapInt32(&entry.referenced, 1, 0) {
+			s.hand = s.hand.Next()
+			continue
+		}
+
+		stopBackgroundSliding(entry.limiter)
+		s.remove(key, entry)
+		return
+	}
+}
+
 // AttributeBasedLimiter is an instance that can manage multiple rate limiter instances
-// with different configutations.
+// with different configutations. The keys are sharded by their hash, so that unrelated
+// keys don't contend on a single lock.
 type AttributeBasedLimiter struct {
-	attributeMap AttributeMap
-	m            sync.Mutex
-	syncMode     bool
+	// keys is accessed atomically, it is kept first to be 64-bit aligned on 32-bit platforms.
+	keys        int64
+	shards      []*attributeShard
+	syncMode    bool
+	limiterType LimiterType
+	opts        []Option
+	factory     LimiterFactory
+	clock       Clock
+
+	policyLock sync.RWMutex
+	policies   map[string]Policy
+	resolver   PolicyResolver
+
+	idleTTL   time.Duration
+	done      chan struct{}
+	closeOnce sync.Once
+
+	maxKeys          int
+	saturationPolicy SaturationPolicy
+	overflow         Limiter
+}
+
+// shard returns the shard of the key, keys are hashed using 32-bit FNV-1a.
+func (a *AttributeBasedLimiter) shard(key string) *attributeShard {
+	hash := uint32(2166136261)
+	for i := 0; i < len(key); i++ {
+		hash ^= uint32(key[i])
+		hash *= 16777619
+	}
+
+	return a.shards[hash%uint32(len(a.shards))]
 }
 
 // HasKey check if AttributeBasedLimiter has a limiter for the key.
@@ -25,9 +228,11 @@ type AttributeBasedLimiter struct {
 //
 // Returns a boolean flag, if true, the key is already present, false otherwise.
 func (a *AttributeBasedLimiter) HasKey(key string) bool {
-	a.m.Lock()
-	_, ok := a.attributeMap[key]
-	a.m.Unlock()
+	shard := a.shard(key)
+
+	shard.m.RLock()
+	_, ok := shard.entries[key]
+	shard.m.RUnlock()
 	return ok
 }
 
@@ -41,28 +246,190 @@ func (a *AttributeBasedLimiter) HasKey(key string) bool {
 //
 // 3. size: duration
 //
-// Returns error if the key already exists.
+// Returns error if the key already exists, the configuration is invalid or the key can't be
+// created because of WithMaxKeys.
 func (a *AttributeBasedLimiter) CreateNewKey(key string, limit uint64, size time.Duration) error {
-	a.m.Lock()
-	defer a.m.Unlock()
+	_, err := a.createNewKey(key, limit, size, "")
+	return err
+}
+
+// AddLimiter associates the given limiter with the key, it can be any Limiter implementation
+// including the ones defined outside of this package. The limiter is killed once the key is
+// deleted or evicted as idle.
+//
+// Parameters:
+//
+// 1. key: a unique key string, example: IP address, token, uuid etc
+//
+// 2. limiter: the limiter of the key.
+//
+// Returns error if the key already exists or the key can't be added because of WithMaxKeys.
+func (a *AttributeBasedLimiter) AddLimiter(key string, limiter Limiter) error {
+	if limiter == nil {
+		return ErrInvalidConfig
+	}
+
+	_, err := a.addLimiter(key, 0, "", func() (Limiter, error) {
+		return limiter, nil
+	})
+
+	return err
+}
 
-	return a.createNewKey(key, limit, size)
+// createNewKey creates the limiter of the key using the given policy name, if any. It returns the
+// limiter of the key along with ErrKeyExists if the key was already created.
+func (a *AttributeBasedLimiter) createNewKey(key string, limit uint64, size time.Duration, policy string) (Limiter, error) {
+	var created Limiter
+	limiter, err := a.addLimiter(key, size, policy, func() (Limiter, error) {
+		limiter, err := a.newLimiter(key, limit, size)
+		if err == nil {
+			created = limiter
+		}
+		return limiter, err
+	})
+
+	// the limiter might have been created before another caller added the key or filled the limiter.
+	if err != nil && created != nil && created != limiter {
+		created.Kill()
+	}
+
+	return limiter, err
 }
 
-func (a *AttributeBasedLimiter) createNewKey(key string, limit uint64, size time.Duration) error {
-	if _, ok := a.attributeMap[key]; ok {
-		return fmt.Errorf(
-			"key %s is already defined", key,
-		)
+// stopBackgroundSliding kills the limiter if it slides it's windows in the background, so that
+// it's goroutine doesn't outlive it's key. Other limiters are left usable by the callers holding them.
+func stopBackgroundSliding(limiter Limiter) {
+	if d, ok := limiter.(*DefaultLimiter); ok {
+		d.Kill()
 	}
+}
 
-	// create a new entry:
-	if !a.syncMode {
-		a.attributeMap[key] = NewDefaultLimiter(limit, size)
-	} else {
-		a.attributeMap[key] = NewSyncLimiter(limit, size)
+// addLimiter adds the limiter returned by create for the key, create is called without the shard locked
+// and only if the key can be added.
+// It returns the limiter of the key along with ErrKeyExists if the key was already added.
+func (a *AttributeBasedLimiter) addLimiter(
+	key string, size time.Duration, policy string, create func() (Limiter, error),
+) (Limiter, error) {
+	shard := a.shard(key)
+
+	shard.m.RLock()
+	entry, ok := shard.entries[key]
+	shard.m.RUnlock()
+
+	if ok {
+		return entry.limiter, fmt.Errorf("%w: %s", ErrKeyExists, key)
+	}
+
+	if a.full() && a.saturationPolicy != EvictColdest {
+		return nil, fmt.Errorf("%w: %s", ErrTooManyKeys, key)
+	}
+
+	// the limiter is created with the shard unlocked, so that create can use the AttributeBasedLimiter
+	// and doesn't block the other keys of the shard meanwhile.
+	limiter, err := create()
+	if err != nil {
+		return nil, err
+	}
+
+	// a factory returning neither a limiter nor an error would leave the key unusable.
+	if limiter == nil {
+		return nil, ErrInvalidConfig
+	}
+
+	shard.m.Lock()
+	defer shard.m.Unlock()
+
+	// the key might have been added by another caller while the limiter was created.
+	if entry, ok := shard.entries[key]; ok {
+		return entry.limiter, fmt.Errorf("%w: %s", ErrKeyExists, key)
+	}
+
+	for a.maxKeys > 0 && !a.reserveKey() {
+		if a.saturationPolicy != EvictColdest {
+			return nil, fmt.Errorf("%w: %s", ErrTooManyKeys, key)
+		}
+
+		if len(shard.entries) > 0 {
+			shard.evictColdest()
+			continue
+		}
+
+		// the shard of the key has no key to evict, the coldest key of another shard is evicted.
+		shard.m.Unlock()
+		a.evictColdest(shard)
+		shard.m.Lock()
+
+		if entry, ok := shard.entries[key]; ok {
+			return entry.limiter, fmt.Errorf("%w: %s", ErrKeyExists, key)
+		}
+	}
+
+	entry = &attributeEntry{limiter: limiter, size: size, policy: policy}
+	entry.touch(a.clock.Now())
+
+	shard.add(key, entry)
+	return limiter, nil
+}
+
+// full reports whether the limiter holds MaxKeys keys.
+func (a *AttributeBasedLimiter) full() bool {
+	return a.maxKeys > 0 && atomic.LoadInt64(&a.keys) >= int64(a.maxKeys)
+}
+
+// reserveKey counts a new key, it returns false if the limiter already holds MaxKeys keys.
+func (a *AttributeBasedLimiter) reserveKey() bool {
+	for {
+		keys := atomic.LoadInt64(&a.keys)
+		if keys >= int64(a.maxKeys) {
+			return false
+		}
+
+		if atomic.CompareAndSwapInt64(&a.keys, keys, keys+1) {
+			return true
+		}
+	}
+}
+
+// evictColdest evicts the coldest key of the first shard having keys other than skip, which must not be locked.
+func (a *AttributeBasedLimiter) evictColdest(skip *attributeShard) {
+	for _, shard := range a.shards {
+		if shard == skip {
+			continue
+		}
+
+		shard.m.Lock()
+		if len(shard.entries) > 0 {
+			shard.evictColdest()
+			shard.m.Unlock()
+			return
+		}
+		shard.m.Unlock()
+	}
+}
+
+// newLimiter creates the limiter of the key using the factory, or the limiter type if there is no factory.
+func (a *AttributeBasedLimiter) newLimiter(key string, limit uint64, size time.Duration) (Limiter, error) {
+	if a.factory != nil {
+		return a.factory(key, limit, size)
+	}
+
+	// limiters are named after the key, unless a name is set by the options.
+	opts := append([]Option{WithName(key)}, a.opts...)
+
+	switch {
+	case a.limiterType == TokenBucket:
+		return NewTokenBucketLimiter(limit, size, opts...)
+	case a.limiterType == GCRA:
+		return NewGCRALimiter(limit, size, opts...)
+	case a.limiterType == SlidingLog:
+		return NewSlidingLogLimiter(limit, size, opts...)
+	case a.limiterType == FixedWindow:
+		return NewFixedWindowLimiter(limit, size, opts...)
+	case !a.syncMode:
+		return NewDefaultLimiter(limit, size, opts...)
+	default:
+		return NewSyncLimiter(limit, size, opts...)
 	}
-	return nil
 }
 
 // HasOrCreateKey check if AttributeBasedLimiter has a limiter for the key.
@@ -78,18 +445,30 @@ func (a *AttributeBasedLimiter) createNewKey(key string, limit uint64, size time
 //
 // Return true if the key exists or is created successfully.
 func (a *AttributeBasedLimiter) HasOrCreateKey(key string, limit uint64, size time.Duration) bool {
-	a.m.Lock()
-	defer a.m.Unlock()
+	_, err := a.getOrCreateLimiter(key, limit, size, "", false)
+	return err == nil
+}
 
-	if _, ok := a.attributeMap[key]; ok {
-		return true
+// getOrCreateLimiter returns the limiter of the key, creating it if the key doesn't exist. The overflow
+// limiter is returned if the key could not be created because of MaxKeys and overflow is true.
+func (a *AttributeBasedLimiter) getOrCreateLimiter(
+	key string, limit uint64, size time.Duration, policy string, overflow bool,
+) (Limiter, error) {
+	if limiter, err := a.getLimiter(key); err == nil {
+		return limiter, nil
 	}
 
-	if err := a.createNewKey(key, limit, size); err == nil {
-		return true
+	limiter, err := a.createNewKey(key, limit, size, policy)
+	if limiter != nil {
+		// the key might have been created by another caller in the meantime.
+		return limiter, nil
 	}
 
-	return false
+	if overflow && a.overflow != nil && a.saturationPolicy == UseOverflowLimiter && errors.Is(err, ErrTooManyKeys) {
+		return a.overflow, nil
+	}
+
+	return nil, err
 }
 
 // ShouldAllow makes decison whether n tasks can be allowed or not.
@@ -104,16 +483,102 @@ func (a *AttributeBasedLimiter) HasOrCreateKey(key string, limit uint64, size ti
 // Returns (bool, error).
 // (false, error) when limiter is inactive (or it is killed) or key is not present.
 // (true/false, nil) if key exists and n tasks can be allowed or not.
+//
+// Keys that are not present are created from their policy if a PolicyResolver is set.
 func (a *AttributeBasedLimiter) ShouldAllow(key string, n uint64) (bool, error) {
-	a.m.Lock()
-	defer a.m.Unlock()
+	limiter, err := a.resolveLimiter(key)
+	if err != nil {
+		return false, err
+	}
 
-	limiter, ok := a.attributeMap[key]
-	if ok {
-		return limiter.ShouldAllow(n)
+	return limiter.ShouldAllow(n)
+}
+
+// Allow makes decison whether n tasks can be allowed or not for the key, just like ShouldAllow,
+// and describes the state of the key's limiter after the decision.
+//
+// Parameters:
+//
+// key: a unique key string, example: IP address, token, uuid etc
+//
+// n: number of tasks to be processed, set this as 1 for a single task.
+// (Example: An HTTP request)
+//
+// Returns (Result, error).
+// (Result{}, error) when limiter is inactive (or it is killed) or key is not present.
+// (Result, nil) if key exists, Result.Allowed is true/false depending on whether n tasks can be allowed or not.
+func (a *AttributeBasedLimiter) Allow(key string, n uint64) (Result, error) {
+	limiter, err := a.resolveLimiter(key)
+	if err != nil {
+		return Result{}, err
+	}
+
+	if rl, ok := limiter.(resultLimiter); ok {
+		return rl.Allow(n)
+	}
+
+	allowed, err := limiter.ShouldAllow(n)
+	return Result{Allowed: allowed}, err
+}
+
+// Peek reports whether n tasks of the key would be allowed right now, without counting them.
+//
+// Parameters:
+//
+// key: a unique key string, example: IP address, token, uuid etc
+//
+// n: number of tasks to be processed, set this as 1 for a single task.
+// (Example: An HTTP request)
+//
+// Returns (bool, error).
+// (false, error) when limiter is inactive (or it is killed), key is not present or it's limiter can't peek.
+// (true/false, nil) if key exists and n tasks would be allowed or not.
+//
+// Keys that are not present are never created, if a PolicyResolver is set, n tasks would be allowed
+// if they are within the limit of the policy of the key, as the key would be created empty.
+func (a *AttributeBasedLimiter) Peek(key string, n uint64) (bool, error) {
+	limiter, err := a.getLimiter(key)
+	if err != nil {
+		policy, err := a.resolvePolicy(key, err, false)
+		if err != nil {
+			return false, err
+		}
+
+		return n <= policy.Limit, nil
+	}
+
+	p, ok := limiter.(peeker)
+	if !ok {
+		return false, fmt.Errorf("%w: limiter of key %s can not peek", ErrNotSupported, key)
 	}
 
-	return false, fmt.Errorf("key %s not found", key)
+	return p.Peek(n)
+}
+
+// Consume counts n tasks of the key that already happened even if they exceed the limit,
+// the tasks of the key are rejected until the overdraft decays.
+//
+// Parameters:
+//
+// key: a unique key string, example: IP address, token, uuid etc
+//
+// n: number of tasks to be counted.
+//
+// Returns (uint64, error).
+// (0, error) when limiter is inactive (or it is killed), key is not present or it's limiter can't overdraw.
+// (debt, nil) if key exists, debt is the number of tasks counted beyond the limit.
+func (a *AttributeBasedLimiter) Consume(key string, n uint64) (uint64, error) {
+	limiter, err := a.resolveLimiter(key)
+	if err != nil {
+		return 0, err
+	}
+
+	c, ok := limiter.(consumer)
+	if !ok {
+		return 0, fmt.Errorf("%w: limiter of key %s can not overdraw", ErrNotSupported, key)
+	}
+
+	return c.Consume(n)
 }
 
 // MustShouldAllow makes decison whether n tasks can be allowed or not.
@@ -132,24 +597,109 @@ func (a *AttributeBasedLimiter) ShouldAllow(key string, n uint64) (bool, error)
 // Returns bool.
 // (false) when limiter is inactive (or it is killed) or n tasks can be not allowed.
 // (true) when n tasks can be allowed or new key-limiter.
+//
+// The tasks of a key that can't be created because of WithMaxKeys are counted on the overflow
+// limiter under the UseOverflowLimiter policy, and are not allowed otherwise (including when
+// WithOverflowLimiter is not used).
 func (a *AttributeBasedLimiter) MustShouldAllow(key string, n uint64, limit uint64, size time.Duration) bool {
-	a.m.Lock()
-	defer a.m.Unlock()
+	limiter, err := a.getOrCreateLimiter(key, limit, size, "", true)
+	if err != nil {
+		return false
+	}
+
+	allowed, err := limiter.ShouldAllow(n)
+	return allowed && err == nil
+}
+
+// UpdateKey changes the configuration of the limiter associated with the key, without
+// losing the tasks already counted by it.
+//
+// Parameters:
+//
+// 1. key: a unique key string, example: IP address, token, uuid etc
+//
+// 2. limit: The number of tasks to be allowd
+//
+// 3. size: duration
+//
+// Returns an error if the key is not present, the configuration is invalid or
+// the limiter of the key can not be reconfigured. Keys created from a policy no longer
+// follow the changes of the policy once updated.
+func (a *AttributeBasedLimiter) UpdateKey(key string, limit uint64, size time.Duration) error {
+	limiter, err := a.getLimiter(key)
+	if err != nil {
+		return err
+	}
+
+	if limit == 0 || size < time.Millisecond {
+		return ErrInvalidConfig
+	}
+
+	if err := reconfigure(key, limiter, limit, size); err != nil {
+		return err
+	}
+
+	// the key no longer follows it's policy.
+	shard := a.shard(key)
+	shard.m.Lock()
+	if entry, ok := shard.entries[key]; ok {
+		entry.size = size
+		entry.policy = ""
+	}
+	shard.m.Unlock()
+
+	return nil
+}
+
+// reconfigure changes the limit and size of the limiter of the key.
+func reconfigure(key string, limiter Limiter, limit uint64, size time.Duration) error {
+	cl, ok := limiter.(configurableLimiter)
+	if !ok {
+		return fmt.Errorf("%w: limiter of key %s can not be reconfigured", ErrNotSupported, key)
+	}
+
+	if wc, ok := limiter.(windowConfigurer); ok {
+		return wc.configure(limit, size)
+	}
 
-	if limiter, ok := a.attributeMap[key]; ok {
-		allowed, err := limiter.ShouldAllow(n)
-		return allowed && err == nil
+	if err := cl.SetSize(size); err != nil {
+		return err
 	}
 
-	err := a.createNewKey(key, limit, size)
+	return cl.SetLimit(limit)
+}
+
+// Return gives back n tasks of the key that were allowed but not performed, the sliding window
+// limiters take them off the window they were counted in, the other limiters give them back right away.
+//
+// Parameters:
+//
+// 1. key: a unique key string, example: IP address, token, uuid etc
+//
+// 2. n: number of tasks to be given back.
+//
+// 3. chargedAt: time at which the tasks were allowed, read from the clock of the limiter
+// (time.Now() unless WithClock is used) right after ShouldAllow returned.
+//
+// Returns an error if the key is not present or the limiter of the key can't give back tasks.
+func (a *AttributeBasedLimiter) Return(key string, n uint64, chargedAt time.Time) error {
+	limiter, err := a.getLimiter(key)
 	if err != nil {
-		return err == nil
+		return err
 	}
 
-	// check ratelimiter on newly created key:
-	limiter := a.attributeMap[key]
-	allowed, err := limiter.ShouldAllow(n)
-	return allowed && err == nil
+	if r, ok := limiter.(returner); ok {
+		r.Return(n, chargedAt)
+		return nil
+	}
+
+	r, ok := limiter.(refunder)
+	if !ok {
+		return fmt.Errorf("%w: limiter of key %s can not give back tasks", ErrNotSupported, key)
+	}
+
+	r.refund(n)
+	return nil
 }
 
 // DeleteKey remove the key and kill its underlying limiter.
@@ -158,22 +708,207 @@ func (a *AttributeBasedLimiter) MustShouldAllow(key string, n uint64, limit uint
 //
 // 1.key: a unique key string, example: IP address, token, uuid etc
 //
-// Returns an error if the key is not present.
+// Returns an error if the key is not present, or if one of it's limiters failed to be killed, the key
+// is removed anyway. Limiters that were already killed are not reported.
 func (a *AttributeBasedLimiter) DeleteKey(key string) error {
+	shard := a.shard(key)
 
-	a.m.Lock()
-	defer a.m.Unlock()
+	shard.m.Lock()
+	defer shard.m.Unlock()
 
-	if limiter, ok := a.attributeMap[key]; ok {
-		err := limiter.Kill()
-		if err != nil {
-			return err
+	concurrencyLimiter, hasConcurrency := shard.concurrencyMap[key]
+	entry, ok := shard.entries[key]
+	if !ok && !hasConcurrency {
+		return fmt.Errorf("%w: %s", ErrKeyNotFound, key)
+	}
+
+	// the key is removed even if it's limiters fail to be killed, a limiter that was already
+	// killed, example: by the caller that added it, is not an error.
+	var err error
+	if ok {
+		if killErr := entry.limiter.Kill(); killErr != nil && !errors.Is(killErr, ErrLimiterKilled) {
+			err = killErr
+		}
+		shard.remove(key, entry)
+	}
+
+	if hasConcurrency {
+		if killErr := concurrencyLimiter.Kill(); killErr != nil && !errors.Is(killErr, ErrLimiterKilled) && err == nil {
+			err = killErr
+		}
+		delete(shard.concurrencyMap, key)
+	}
+
+	return err
+}
+
+// CreateConcurrencyKey associates a ConcurrencyLimiter with the key, it is independent of the
+// rate limiter of the key, so both the rate and the number of tasks in-flight can be limited.
+//
+// Parameters:
+//
+// 1. key: a unique key string, example: IP address, token, uuid etc
+//
+// 2. limit: The maximum number of tasks in-flight.
+//
+// Returns error if the key already has a concurrency limiter.
+func (a *AttributeBasedLimiter) CreateConcurrencyKey(key string, limit uint64) error {
+	shard := a.shard(key)
+
+	shard.m.Lock()
+	defer shard.m.Unlock()
+
+	if _, ok := shard.concurrencyMap[key]; ok {
+		return fmt.Errorf("%w: %s", ErrKeyExists, key)
+	}
+
+	limiter, err := NewConcurrencyLimiter(limit, append([]Option{WithName(key)}, a.opts...)...)
+	if err != nil {
+		return err
+	}
+
+	shard.concurrencyMap[key] = limiter
+	return nil
+}
+
+// getLimiter looks up the limiter of the key and marks the key as used, the shard is only
+// read-locked during the lookup.
+func (a *AttributeBasedLimiter) getLimiter(key string) (Limiter, error) {
+	shard := a.shard(key)
+
+	shard.m.RLock()
+	defer shard.m.RUnlock()
+
+	entry, ok := shard.entries[key]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrKeyNotFound, key)
+	}
+
+	// the key is marked as used before the shard is unlocked, so that the janitor
+	// does not evict it while it is being used.
+	if a.idleTTL > 0 {
+		entry.touch(a.clock.Now())
+	}
+
+	if a.maxKeys > 0 {
+		entry.reference()
+	}
+
+	return entry.limiter, nil
+}
+
+func (a *AttributeBasedLimiter) getConcurrencyLimiter(key string) (*ConcurrencyLimiter, error) {
+	shard := a.shard(key)
+
+	shard.m.RLock()
+	limiter, ok := shard.concurrencyMap[key]
+	shard.m.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrKeyNotFound, key)
+	}
+
+	return limiter, nil
+}
+
+// TryAcquire acquires the capacity for n tasks of the key without blocking.
+//
+// Parameters:
+//
+// 1. key: a unique key string, example: IP address, token, uuid etc
+//
+// 2. n: number of tasks to be processed.
+//
+// Returns (bool, error).
+// (false, error) when limiter is inactive (or it is killed) or key has no concurrency limiter.
+// (true/false, nil) depending on whether the capacity for n tasks was acquired or not.
+func (a *AttributeBasedLimiter) TryAcquire(key string, n uint64) (bool, error) {
+	limiter, err := a.getConcurrencyLimiter(key)
+	if err != nil {
+		return false, err
+	}
+
+	return limiter.TryAcquire(n)
+}
+
+// Acquire blocks until the capacity for n tasks of the key is acquired or until ctx is done.
+// The map is not locked while waiting, so other keys are not blocked.
+//
+// Parameters:
+//
+// 1. ctx: context used to cancel the wait.
+//
+// 2. key: a unique key string, example: IP address, token, uuid etc
+//
+// 3. n: number of tasks to be processed.
+//
+// Returns nil once the capacity is acquired, ctx.Err() if ctx is done before that, or an error
+// if the key has no concurrency limiter, limiter is inactive (or it is killed) or n can never be acquired.
+func (a *AttributeBasedLimiter) Acquire(ctx context.Context, key string, n uint64) error {
+	limiter, err := a.getConcurrencyLimiter(key)
+	if err != nil {
+		return err
+	}
+
+	return limiter.Acquire(ctx, n)
+}
+
+// Release gives back the capacity of n tasks of the key acquired earlier.
+//
+// Parameters:
+//
+// 1. key: a unique key string, example: IP address, token, uuid etc
+//
+// 2. n: number of tasks that are done.
+//
+// Returns an error if the key has no concurrency limiter.
+func (a *AttributeBasedLimiter) Release(key string, n uint64) error {
+	limiter, err := a.getConcurrencyLimiter(key)
+	if err != nil {
+		return err
+	}
+
+	limiter.Release(n)
+	return nil
+}
+
+// evictIdleKeys removes the keys whose windows have been empty for the idle TTL and kills their limiters.
+func (a *AttributeBasedLimiter) evictIdleKeys() {
+	for _, shard := range a.shards {
+		shard.m.Lock()
+		now := a.clock.Now()
+		for key, entry := range shard.entries {
+			if entry.idle(now, a.idleTTL) {
+				entry.limiter.Kill()
+				shard.remove(key, entry)
+			}
+		}
+		shard.m.Unlock()
+	}
+}
+
+// janitor evicts the idle keys every idle TTL, until the limiter is closed.
+func (a *AttributeBasedLimiter) janitor() {
+	for {
+		timer := a.clock.NewTimer(a.idleTTL)
+		select {
+		case <-timer.C():
+			a.evictIdleKeys()
+		case <-a.done:
+			timer.Stop()
+			return
 		}
-		delete(a.attributeMap, key)
-		return nil
 	}
+}
+
+// Close stops the janitor evicting the idle keys, the keys are retained and can still be used.
+// It is safe to call Close more than once, or on a limiter without an idle TTL.
+func (a *AttributeBasedLimiter) Close() error {
+	a.closeOnce.Do(func() {
+		close(a.done)
+	})
 
-	return fmt.Errorf("key %s not found", key)
+	return nil
 }
 
 // NewAttributeBasedLimiter creates an instance of AttributeBasedLimiter and returns it's pointer.
@@ -182,9 +917,44 @@ func (a *AttributeBasedLimiter) DeleteKey(key string) error {
 //
 // 1. backgroundSliding: if set to true, DefaultLimiter will be used as an underlying limiter,
 // else, SyncLimiter will be used.
-func NewAttributeBasedLimiter(backgroundSliding bool) *AttributeBasedLimiter {
-	return &AttributeBasedLimiter{
-		attributeMap: make(AttributeMap),
-		syncMode:     !backgroundSliding,
+//
+// 2. opts: optional parameters applied to the limiter of every key, example: WithClock,
+// WithLimiterType, WithLimiterFactory, WithShards, WithIdleTTL, WithMaxKeys
+func NewAttributeBasedLimiter(backgroundSliding bool, opts ...Option) *AttributeBasedLimiter {
+	o := newOptions(opts)
+
+	limiter := &AttributeBasedLimiter{
+		shards:      make([]*attributeShard, o.shards),
+		syncMode:    !backgroundSliding,
+		limiterType: o.limiterType,
+		opts:        opts,
+		factory:     o.factory,
+		clock:       o.clock,
+		policies:    make(map[string]Policy),
+		idleTTL:     o.idleTTL,
+		done:        make(chan struct{}),
+
+		maxKeys:          o.maxKeys,
+		saturationPolicy: o.saturationPolicy,
+		overflow:         o.overflow,
+	}
+
+	for idx := range limiter.shards {
+		limiter.shards[idx] = &attributeShard{
+			entries:        make(map[string]*attributeEntry),
+			concurrencyMap: make(map[string]*ConcurrencyLimiter),
+			ring:           list.New(),
+		}
+
+		// MaxKeys bounds the keys of all the shards, a full limiter evicts the coldest key of the shard of the new key.
+		if limiter.maxKeys > 0 {
+			limiter.shards[idx].keys = &limiter.keys
+		}
 	}
+
+	if limiter.idleTTL > 0 {
+		go limiter.janitor()
+	}
+
+	return limiter
 }
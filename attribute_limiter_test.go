@@ -1,8 +1,11 @@
 package ratelimiter
 
 import (
+	"errors"
 	"fmt"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -322,3 +325,520 @@ func TestAttributeBasedLimiterAccuracySync(t *testing.T) {
 		isDry = false
 	}
 }
+
+func TestAttributeBasedLimiterAllow(t *testing.T) {
+	attributeLimiter := NewAttributeBasedLimiter(false)
+
+	if _, err := attributeLimiter.Allow("noKey", 1); err == nil {
+		t.Fatalf("AttributeBasedLimiter.Allow() failed, did not return error when checking non-existing key.")
+	}
+
+	if err := attributeLimiter.CreateNewKey("key", 5, time.Second); err != nil {
+		t.Fatalf("AttributeBasedLimiter.CreateNewKey() failed, Error: %v", err)
+	}
+
+	result, err := attributeLimiter.Allow("key", 5)
+	if err != nil {
+		t.Fatalf("AttributeBasedLimiter.Allow() failed, Error: %v", err)
+	}
+
+	if !result.Allowed || result.Limit != 5 || result.Remaining != 0 {
+		t.Fatalf("AttributeBasedLimiter.Allow() returned unexpected result %+v", result)
+	}
+
+	result, err = attributeLimiter.Allow("key", 1)
+	if err != nil {
+		t.Fatalf("AttributeBasedLimiter.Allow() failed, Error: %v", err)
+	}
+
+	if result.Allowed || result.RetryAfter == 0 {
+		t.Fatalf("AttributeBasedLimiter.Allow() returned unexpected result %+v", result)
+	}
+}
+
+func TestAttributeBasedLimiterUpdateKey(t *testing.T) {
+	attributeLimiter := NewAttributeBasedLimiter(false)
+
+	if err := attributeLimiter.UpdateKey("noKey", 10, time.Second); err == nil {
+		t.Fatalf("AttributeBasedLimiter.UpdateKey() failed, did not return error when updating non-existing key.")
+	}
+
+	if err := attributeLimiter.CreateNewKey("key", 5, time.Minute); err != nil {
+		t.Fatalf("AttributeBasedLimiter.CreateNewKey() failed, Error: %v", err)
+	}
+
+	if allowed, _ := attributeLimiter.ShouldAllow("key", 5); !allowed {
+		t.Fatalf("AttributeBasedLimiter.ShouldAllow() failed to allow tasks within the limit")
+	}
+
+	if err := attributeLimiter.UpdateKey("key", 0, time.Minute); err == nil {
+		t.Fatalf("AttributeBasedLimiter.UpdateKey() failed, did not return error for invalid configuration.")
+	}
+
+	if err := attributeLimiter.UpdateKey("key", 10, time.Minute); err != nil {
+		t.Fatalf("AttributeBasedLimiter.UpdateKey() failed, Error: %v", err)
+	}
+
+	// the tasks counted before the update are retained:
+	if allowed, _ := attributeLimiter.ShouldAllow("key", 6); allowed {
+		t.Fatalf("AttributeBasedLimiter.UpdateKey() failed, counted tasks were lost")
+	}
+
+	if allowed, _ := attributeLimiter.ShouldAllow("key", 5); !allowed {
+		t.Fatalf("AttributeBasedLimiter.UpdateKey() failed, new limit was not applied")
+	}
+}
+
+func TestAttributeBasedLimiterReturn(t *testing.T) {
+	attributeLimiter := NewAttributeBasedLimiter(false)
+
+	if err := attributeLimiter.Return("noKey", 1, time.Now()); err == nil {
+		t.Fatalf("AttributeBasedLimiter.Return() failed, did not return error for non-existing key.")
+	}
+
+	attributeLimiter.CreateNewKey("key", 5, time.Minute)
+	if allowed, _ := attributeLimiter.ShouldAllow("key", 5); !allowed {
+		t.Fatalf("AttributeBasedLimiter.ShouldAllow() failed to allow tasks within the limit")
+	}
+	chargedAt := time.Now()
+
+	if err := attributeLimiter.Return("key", 2, chargedAt); err != nil {
+		t.Fatalf("AttributeBasedLimiter.Return() failed, Error: %v", err)
+	}
+
+	if allowed, _ := attributeLimiter.ShouldAllow("key", 2); !allowed {
+		t.Fatalf("AttributeBasedLimiter.Return() failed, tasks were not given back")
+	}
+
+	if allowed, _ := attributeLimiter.ShouldAllow("key", 1); allowed {
+		t.Fatalf("AttributeBasedLimiter.Return() failed, more tasks were given back than returned")
+	}
+}
+
+func TestAttributeBasedLimiterPeek(t *testing.T) {
+	limiterTypes := []LimiterType{SlidingWindow, TokenBucket, GCRA, SlidingLog, FixedWindow}
+
+	for _, limiterType := range limiterTypes {
+		clock := NewManualClock(time.Unix(1000, 0))
+		attributeLimiter := NewAttributeBasedLimiter(false, WithClock(clock), WithLimiterType(limiterType))
+
+		if _, err := attributeLimiter.Peek("noKey", 1); err == nil {
+			t.Fatalf("AttributeBasedLimiter.Peek() failed, did not return error for non-existing key.")
+		}
+
+		attributeLimiter.CreateNewKey("key", 5, time.Minute)
+		attributeLimiter.ShouldAllow("key", 3)
+
+		// peeking does not count the tasks:
+		for i := 0; i < 2; i++ {
+			if allowed, err := attributeLimiter.Peek("key", 2); !allowed || err != nil {
+				t.Fatalf("AttributeBasedLimiter.Peek() on limiter type %d returned (%v, %v), expected (true, nil)", limiterType, allowed, err)
+			}
+		}
+
+		if allowed, _ := attributeLimiter.Peek("key", 3); allowed {
+			t.Fatalf("AttributeBasedLimiter.Peek() on limiter type %d allowed tasks beyond the limit", limiterType)
+		}
+
+		// every limiter type has capacity for 5 tasks again after 2 minutes.
+		clock.Advance(2 * time.Minute)
+		if allowed, _ := attributeLimiter.Peek("key", 5); !allowed {
+			t.Fatalf("AttributeBasedLimiter.Peek() on limiter type %d did not account for the elapsed time", limiterType)
+		}
+
+		if allowed, _ := attributeLimiter.ShouldAllow("key", 5); !allowed {
+			t.Fatalf("AttributeBasedLimiter.ShouldAllow() on limiter type %d did not allow the tasks Peek() reported as allowed", limiterType)
+		}
+	}
+}
+
+func TestAttributeBasedLimiterConsume(t *testing.T) {
+	attributeLimiter := NewAttributeBasedLimiter(false)
+
+	if _, err := attributeLimiter.Consume("noKey", 1); err == nil {
+		t.Fatalf("AttributeBasedLimiter.Consume() failed, did not return error for non-existing key.")
+	}
+
+	attributeLimiter.CreateNewKey("key", 5, time.Minute)
+	if debt, err := attributeLimiter.Consume("key", 8); debt != 3 || err != nil {
+		t.Fatalf("AttributeBasedLimiter.Consume() returned (%d, %v), expected (3, nil)", debt, err)
+	}
+
+	if allowed, _ := attributeLimiter.ShouldAllow("key", 1); allowed {
+		t.Fatalf("AttributeBasedLimiter.ShouldAllow() allowed tasks while in overdraft")
+	}
+}
+
+func TestAttributeBasedLimiterShards(t *testing.T) {
+	for _, shards := range []int{0, 1, 8} {
+		attributeLimiter := NewAttributeBasedLimiter(false, WithShards(shards))
+
+		expected := shards
+		if shards == 0 {
+			expected = DefaultShards
+		}
+
+		if len(attributeLimiter.shards) != expected {
+			t.Fatalf("WithShards(%d) created %d shards, expected %d", shards, len(attributeLimiter.shards), expected)
+		}
+
+		wg := sync.WaitGroup{}
+		for i := 0; i < 64; i++ {
+			wg.Add(1)
+			go func(key string) {
+				defer wg.Done()
+				if !attributeLimiter.MustShouldAllow(key, 1, 1, time.Minute) {
+					t.Errorf("MustShouldAllow(%s) did not allow the first task of the key", key)
+				}
+				if attributeLimiter.MustShouldAllow(key, 1, 1, time.Minute) {
+					t.Errorf("MustShouldAllow(%s) allowed tasks beyond the limit", key)
+				}
+			}(fmt.Sprintf("key-%d", i))
+		}
+		wg.Wait()
+
+		keys := 0
+		for _, shard := range attributeLimiter.shards {
+			keys += len(shard.entries)
+		}
+
+		if keys != 64 {
+			t.Fatalf("%d keys were found across the shards, expected 64", keys)
+		}
+	}
+}
+
+func BenchmarkConcurrentAttributeBasedLimiter(b *testing.B) {
+	attributeLimiter := NewAttributeBasedLimiter(false)
+	keys := make([]string, 1024)
+	for idx := range keys {
+		keys[idx] = fmt.Sprintf("key-%d", idx)
+		attributeLimiter.CreateNewKey(keys[idx], 100, time.Second)
+	}
+
+	var worker uint64
+	b.RunParallel(func(p *testing.PB) {
+		i := atomic.AddUint64(&worker, 1) * 97
+		for p.Next() {
+			_, err := attributeLimiter.ShouldAllow(keys[i%uint64(len(keys))], 1)
+			if err != nil {
+				b.Fatalf("Error when calling ShouldAllow() on active limiter, Error: %v", err)
+			}
+			i++
+		}
+	})
+}
+
+func TestAttributeBasedLimiterIdleTTL(t *testing.T) {
+	clock := NewManualClock(time.Unix(1000, 0))
+	attributeLimiter := NewAttributeBasedLimiter(false, WithClock(clock), WithIdleTTL(time.Minute))
+
+	attributeLimiter.MustShouldAllow("active", 1, 10, time.Second)
+	attributeLimiter.MustShouldAllow("idle", 1, 10, time.Second)
+	idleLimiter, _ := attributeLimiter.getLimiter("idle")
+
+	// the windows of both the keys have not been empty for the TTL yet:
+	clock.BlockUntil(1)
+	clock.Advance(time.Minute)
+	clock.BlockUntil(1)
+
+	if !attributeLimiter.HasKey("active") || !attributeLimiter.HasKey("idle") {
+		t.Fatalf("janitor evicted keys before their windows were empty for the TTL")
+	}
+
+	attributeLimiter.ShouldAllow("active", 1)
+
+	clock.Advance(time.Minute)
+	clock.BlockUntil(1)
+
+	if attributeLimiter.HasKey("idle") {
+		t.Fatalf("janitor did not evict the idle key")
+	}
+
+	if _, err := idleLimiter.ShouldAllow(1); err == nil {
+		t.Fatalf("limiter of the evicted key was not killed")
+	}
+
+	if !attributeLimiter.HasKey("active") {
+		t.Fatalf("janitor evicted the key used within the TTL")
+	}
+
+	// evicted keys are created again on demand:
+	if !attributeLimiter.MustShouldAllow("idle", 1, 10, time.Second) {
+		t.Fatalf("MustShouldAllow() did not create the evicted key again")
+	}
+
+	attributeLimiter.Close()
+	waitForTimers(t, clock, 0)
+
+	clock.Advance(time.Hour)
+	if !attributeLimiter.HasKey("active") {
+		t.Fatalf("keys were evicted after Close()")
+	}
+
+	if err := attributeLimiter.Close(); err != nil {
+		t.Fatalf("Close() returned error %v when called twice", err)
+	}
+}
+
+// waitForTimers waits until exactly n timers are waiting on the clock.
+func waitForTimers(t *testing.T, clock *ManualClock, n int) {
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		clock.lock.Lock()
+		waiting := len(clock.timers)
+		clock.lock.Unlock()
+
+		if waiting == n {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	t.Fatalf("timed out waiting for %d timers on the clock", n)
+}
+
+func TestAttributeBasedLimiterMaxKeys(t *testing.T) {
+	attributeLimiter := NewAttributeBasedLimiter(false, WithShards(1), WithMaxKeys(3))
+
+	for _, key := range []string{"a", "b", "c"} {
+		attributeLimiter.CreateNewKey(key, 10, time.Minute)
+	}
+	evicted, _ := attributeLimiter.getLimiter("a")
+
+	// no key was used since it was created, the oldest key is evicted:
+	attributeLimiter.CreateNewKey("d", 10, time.Minute)
+
+	// b is used, so c is colder than b:
+	attributeLimiter.ShouldAllow("b", 1)
+	attributeLimiter.CreateNewKey("e", 10, time.Minute)
+
+	for key, expected := range map[string]bool{"a": false, "b": true, "c": false, "d": true, "e": true} {
+		if attributeLimiter.HasKey(key) != expected {
+			t.Fatalf("HasKey(%s) returned %v, expected %v", key, !expected, expected)
+		}
+	}
+
+	// callers still holding the limiter of an evicted key can keep using it:
+	if _, err := evicted.ShouldAllow(1); err != nil {
+		t.Fatalf("limiter of the evicted key was killed, Error: %v", err)
+	}
+
+	// unless it slides it's windows in the background:
+	attributeLimiter = NewAttributeBasedLimiter(true, WithShards(1), WithMaxKeys(1))
+	attributeLimiter.CreateNewKey("a", 10, time.Minute)
+	evicted, _ = attributeLimiter.getLimiter("a")
+	attributeLimiter.CreateNewKey("b", 10, time.Minute)
+
+	if _, err := evicted.ShouldAllow(1); err == nil {
+		t.Fatalf("background sliding of the evicted key was not stopped")
+	}
+}
+
+func TestAttributeBasedLimiterMaxKeysAcrossShards(t *testing.T) {
+	attributeLimiter := NewAttributeBasedLimiter(false, WithMaxKeys(64), WithSaturationPolicy(RejectNewKeys))
+
+	created := 0
+	for i := 0; i < 100; i++ {
+		if err := attributeLimiter.CreateNewKey(fmt.Sprintf("key-%d", i), 10, time.Minute); err == nil {
+			created++
+		}
+	}
+
+	// the bound applies to the limiter as a whole, not to each shard:
+	if created != 64 || attributeLimiter.Len() != 64 {
+		t.Fatalf("%d keys were created and %d are held, expected 64", created, attributeLimiter.Len())
+	}
+
+	attributeLimiter = NewAttributeBasedLimiter(false, WithMaxKeys(64))
+	for i := 0; i < 1000; i++ {
+		if err := attributeLimiter.CreateNewKey(fmt.Sprintf("key-%d", i), 10, time.Minute); err != nil {
+			t.Fatalf("CreateNewKey() returned error %v under EvictColdest", err)
+		}
+
+		if attributeLimiter.Len() > 64 {
+			t.Fatalf("%d keys are held, expected at most 64", attributeLimiter.Len())
+		}
+	}
+
+	// a key of another shard is evicted when the shard of the new key has no key:
+	attributeLimiter = NewAttributeBasedLimiter(false, WithMaxKeys(1))
+	attributeLimiter.CreateNewKey("a", 10, time.Minute)
+
+	key := "b"
+	for i := 0; attributeLimiter.shard(key) == attributeLimiter.shard("a"); i++ {
+		key = fmt.Sprintf("key-%d", i)
+	}
+
+	if err := attributeLimiter.CreateNewKey(key, 10, time.Minute); err != nil {
+		t.Fatalf("CreateNewKey() returned error %v under EvictColdest", err)
+	}
+
+	if attributeLimiter.HasKey("a") || !attributeLimiter.HasKey(key) {
+		t.Fatalf("the key of another shard was not evicted")
+	}
+}
+
+func TestAttributeBasedLimiterSaturationPolicy(t *testing.T) {
+	attributeLimiter := NewAttributeBasedLimiter(false, WithShards(1), WithMaxKeys(1), WithSaturationPolicy(RejectNewKeys))
+	attributeLimiter.CreateNewKey("a", 10, time.Minute)
+
+	if err := attributeLimiter.CreateNewKey("b", 10, time.Minute); !errors.Is(err, ErrTooManyKeys) {
+		t.Fatalf("CreateNewKey() returned %v when full, expected %v", err, ErrTooManyKeys)
+	}
+
+	if attributeLimiter.MustShouldAllow("b", 1, 10, time.Minute) || attributeLimiter.HasOrCreateKey("b", 10, time.Minute) {
+		t.Fatalf("new keys were allowed when full under RejectNewKeys")
+	}
+
+	// deleting a key makes room for a new key:
+	attributeLimiter.DeleteKey("a")
+	if !attributeLimiter.MustShouldAllow("b", 1, 10, time.Minute) {
+		t.Fatalf("MustShouldAllow() did not create the key after another key was deleted")
+	}
+
+	overflow, _ := NewSyncLimiter(2, time.Minute)
+	attributeLimiter = NewAttributeBasedLimiter(false,
+		WithShards(1), WithMaxKeys(1), WithSaturationPolicy(UseOverflowLimiter), WithOverflowLimiter(overflow),
+	)
+	attributeLimiter.CreateNewKey("a", 10, time.Minute)
+
+	// keys that can't be created share the overflow limiter:
+	if !attributeLimiter.MustShouldAllow("b", 1, 10, time.Minute) || !attributeLimiter.MustShouldAllow("c", 1, 10, time.Minute) {
+		t.Fatalf("MustShouldAllow() did not fall back to the overflow limiter when full")
+	}
+
+	if attributeLimiter.MustShouldAllow("d", 1, 10, time.Minute) {
+		t.Fatalf("MustShouldAllow() allowed tasks beyond the limit of the overflow limiter")
+	}
+
+	if attributeLimiter.HasKey("b") || !attributeLimiter.HasKey("a") {
+		t.Fatalf("keys were created or evicted when full under UseOverflowLimiter")
+	}
+
+	// without an overflow limiter, UseOverflowLimiter behaves like RejectNewKeys:
+	attributeLimiter = NewAttributeBasedLimiter(false,
+		WithShards(1), WithMaxKeys(1), WithSaturationPolicy(UseOverflowLimiter),
+	)
+	attributeLimiter.CreateNewKey("a", 10, time.Minute)
+
+	if attributeLimiter.MustShouldAllow("b", 1, 10, time.Minute) {
+		t.Fatalf("MustShouldAllow() allowed tasks of a key that can't be created without an overflow limiter")
+	}
+
+	if err := attributeLimiter.CreateNewKey("b", 10, time.Minute); !errors.Is(err, ErrTooManyKeys) {
+		t.Fatalf("CreateNewKey() returned %v when full, expected %v", err, ErrTooManyKeys)
+	}
+}
+
+func TestAttributeBasedLimiterAddLimiter(t *testing.T) {
+	attributeLimiter := NewAttributeBasedLimiter(false)
+	custom := &countingLimiter{limit: 2}
+
+	if err := attributeLimiter.AddLimiter("custom", custom); err != nil {
+		t.Fatalf("AddLimiter() returned error %v", err)
+	}
+
+	if err := attributeLimiter.AddLimiter("custom", &countingLimiter{limit: 2}); !errors.Is(err, ErrKeyExists) {
+		t.Fatalf("AddLimiter() returned %v for existing key, expected %v", err, ErrKeyExists)
+	}
+
+	gcra, _ := NewGCRALimiter(1, time.Minute)
+	attributeLimiter.AddLimiter("gcra", gcra)
+	attributeLimiter.CreateNewKey("sliding", 1, time.Minute)
+
+	// every key is limited by it's own limiter type:
+	if allowed, _ := attributeLimiter.ShouldAllow("custom", 2); !allowed || custom.count != 2 {
+		t.Fatalf("ShouldAllow() did not use the limiter added for the key")
+	}
+
+	if result, _ := attributeLimiter.Allow("custom", 1); result.Allowed {
+		t.Fatalf("Allow() allowed tasks beyond the limit of the added limiter")
+	}
+
+	for _, key := range []string{"gcra", "sliding"} {
+		if allowed, _ := attributeLimiter.ShouldAllow(key, 1); !allowed {
+			t.Fatalf("ShouldAllow(%s) did not allow the first task", key)
+		}
+		if allowed, _ := attributeLimiter.ShouldAllow(key, 1); allowed {
+			t.Fatalf("ShouldAllow(%s) allowed tasks beyond the limit", key)
+		}
+	}
+
+	if _, err := attributeLimiter.Peek("custom", 1); err == nil {
+		t.Fatalf("Peek() did not return error for a limiter that can't peek")
+	}
+
+	attributeLimiter.DeleteKey("gcra")
+	if _, err := gcra.ShouldAllow(1); err == nil {
+		t.Fatalf("limiter added for the deleted key was not killed")
+	}
+}
+
+func TestAttributeBasedLimiterFactory(t *testing.T) {
+	factory := func(key string, limit uint64, size time.Duration) (Limiter, error) {
+		if strings.HasPrefix(key, "upload:") {
+			return NewTokenBucketLimiter(limit, size, WithBurst(1))
+		}
+		return NewSyncLimiter(limit, size)
+	}
+
+	attributeLimiter := NewAttributeBasedLimiter(true, WithLimiterFactory(factory))
+	attributeLimiter.CreateNewKey("upload:alice", 10, time.Minute)
+	attributeLimiter.MustShouldAllow("api:alice", 1, 10, time.Minute)
+
+	limiter, _ := attributeLimiter.getLimiter("upload:alice")
+	if _, ok := limiter.(*TokenBucketLimiter); !ok {
+		t.Fatalf("AttributeBasedLimiter did not create the key using the factory")
+	}
+
+	limiter, _ = attributeLimiter.getLimiter("api:alice")
+	if _, ok := limiter.(*SyncLimiter); !ok {
+		t.Fatalf("AttributeBasedLimiter did not create the key using the factory")
+	}
+
+	if err := attributeLimiter.CreateNewKey("upload:bob", 0, time.Minute); err == nil {
+		t.Fatalf("CreateNewKey() did not return the error of the factory")
+	}
+
+	if attributeLimiter.HasKey("upload:bob") {
+		t.Fatalf("key was created although the factory returned an error")
+	}
+
+	attributeLimiter = NewAttributeBasedLimiter(false, WithLimiterFactory(
+		func(key string, limit uint64, size time.Duration) (Limiter, error) {
+			return nil, nil
+		},
+	))
+
+	if err := attributeLimiter.CreateNewKey("key", 10, time.Minute); !errors.Is(err, ErrInvalidConfig) {
+		t.Fatalf("CreateNewKey() returned %v when the factory returned no limiter, expected %v", err, ErrInvalidConfig)
+	}
+
+	if attributeLimiter.HasKey("key") || attributeLimiter.MustShouldAllow("key", 1, 10, time.Minute) {
+		t.Fatalf("key was created although the factory returned no limiter")
+	}
+
+	// the factory can use the limiter, as it is called without the shard locked:
+	var created *SyncLimiter
+	attributeLimiter = NewAttributeBasedLimiter(false)
+	attributeLimiter.factory = func(key string, limit uint64, size time.Duration) (Limiter, error) {
+		if attributeLimiter.HasKey(key) {
+			t.Fatalf("factory called for an existing key")
+		}
+
+		// another caller creates the key meanwhile:
+		attributeLimiter.AddLimiter(key, &countingLimiter{limit: limit})
+
+		created, _ = NewSyncLimiter(limit, size)
+		return created, nil
+	}
+
+	if err := attributeLimiter.CreateNewKey("key", 10, time.Minute); !errors.Is(err, ErrKeyExists) {
+		t.Fatalf("CreateNewKey() returned %v when the key was created meanwhile, expected %v", err, ErrKeyExists)
+	}
+
+	if _, err := created.ShouldAllow(1); !errors.Is(err, ErrLimiterKilled) {
+		t.Fatalf("limiter created for a key created meanwhile was not killed")
+	}
+}
@@ -0,0 +1,225 @@
+package ratelimiter
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock is the source of time used by the limiters, it can be replaced using WithClock
+// option, for example with a ManualClock in tests.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+	// Sleep pauses the current goroutine for at least the duration d.
+	Sleep(d time.Duration)
+	// After waits for the duration to elapse and then sends the current time on the returned channel.
+	After(d time.Duration) <-chan time.Time
+	// NewTimer creates a new Timer that will send the current time on it's channel after at least duration d.
+	NewTimer(d time.Duration) Timer
+}
+
+// Timer is the interface of a single event timer created by a Clock, it behaves like time.Timer.
+type Timer interface {
+	// C returns the channel on which the time is delivered.
+	C() <-chan time.Time
+	// Stop prevents the Timer from firing, returns false if the timer has already expired or been stopped.
+	Stop() bool
+	// Reset changes the timer to expire after duration d, returns true if the timer had been active.
+	Reset(d time.Duration) bool
+}
+
+// realClock implements Clock using the functions of the time package.
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) Sleep(d time.Duration) {
+	time.Sleep(d)
+}
+
+func (realClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+func (realClock) NewTimer(d time.Duration) Timer {
+	return &realTimer{timer: time.NewTimer(d)}
+}
+
+type realTimer struct {
+	timer *time.Timer
+}
+
+func (t *realTimer) C() <-chan time.Time {
+	return t.timer.C
+}
+
+func (t *realTimer) Stop() bool {
+	return t.timer.Stop()
+}
+
+func (t *realTimer) Reset(d time.Duration) bool {
+	return t.timer.Reset(d)
+}
+
+// ManualClock is a Clock whose time only changes when it is advanced explicitly,
+// timers and sleepers are fired as soon as the clock passes their deadline.
+// It makes the window slides of the limiters testable without waiting for them,
+// use NewManualClock to create one.
+type ManualClock struct {
+	lock   sync.Mutex
+	cond   *sync.Cond
+	now    time.Time
+	timers []*manualTimer
+}
+
+type manualTimer struct {
+	clock    *ManualClock
+	c        chan time.Time
+	deadline time.Time
+	active   bool
+}
+
+// Now returns the current time of the clock.
+func (c *ManualClock) Now() time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.now
+}
+
+// Sleep blocks until the clock is advanced by at least the duration d.
+func (c *ManualClock) Sleep(d time.Duration) {
+	<-c.After(d)
+}
+
+// After returns a channel on which the time is sent once the clock is advanced by at least the duration d.
+func (c *ManualClock) After(d time.Duration) <-chan time.Time {
+	return c.NewTimer(d).C()
+}
+
+// NewTimer creates a Timer that fires once the clock is advanced by at least the duration d.
+func (c *ManualClock) NewTimer(d time.Duration) Timer {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	timer := &manualTimer{
+		clock: c,
+		c:     make(chan time.Time, 1),
+	}
+
+	c.schedule(timer, d)
+	return timer
+}
+
+// Advance moves the clock forward by the duration d, firing all the timers that expire meanwhile.
+func (c *ManualClock) Advance(d time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.now = c.now.Add(d)
+	c.fire()
+}
+
+// Set moves the clock to the time t, firing all the timers that expire meanwhile.
+func (c *ManualClock) Set(t time.Time) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.now = t
+	c.fire()
+}
+
+// BlockUntil blocks until at least n timers (or sleepers) are waiting on the clock, this can be used
+// to make sure a goroutine is parked on the clock before advancing it.
+func (c *ManualClock) BlockUntil(n int) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	for len(c.timers) < n {
+		c.cond.Wait()
+	}
+}
+
+// schedule (re)arms the timer to expire after d, must be called with lock held.
+func (c *ManualClock) schedule(timer *manualTimer, d time.Duration) {
+	timer.deadline = c.now.Add(d)
+	if !timer.active {
+		timer.active = true
+		c.timers = append(c.timers, timer)
+	}
+
+	c.fire()
+	c.cond.Broadcast()
+}
+
+// fire sends the current time to all the expired timers, must be called with lock held.
+func (c *ManualClock) fire() {
+	pending := c.timers[:0]
+	for _, timer := range c.timers {
+		if timer.deadline.After(c.now) {
+			pending = append(pending, timer)
+			continue
+		}
+
+		timer.active = false
+		select {
+		case timer.c <- c.now:
+		default:
+		}
+	}
+
+	// clear the references to fired timers.
+	for idx := len(pending); idx < len(c.timers); idx++ {
+		c.timers[idx] = nil
+	}
+	c.timers = pending
+}
+
+// remove unregisters the timer from the clock, must be called with lock held.
+func (c *ManualClock) remove(timer *manualTimer) {
+	for idx, t := range c.timers {
+		if t == timer {
+			c.timers = append(c.timers[:idx], c.timers[idx+1:]...)
+			return
+		}
+	}
+}
+
+func (t *manualTimer) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *manualTimer) Stop() bool {
+	t.clock.lock.Lock()
+	defer t.clock.lock.Unlock()
+
+	wasActive := t.active
+	if wasActive {
+		t.active = false
+		t.clock.remove(t)
+	}
+
+	return wasActive
+}
+
+func (t *manualTimer) Reset(d time.Duration) bool {
+	t.clock.lock.Lock()
+	defer t.clock.lock.Unlock()
+
+	wasActive := t.active
+	t.clock.schedule(t, d)
+	return wasActive
+}
+
+// NewManualClock creates an instance of ManualClock set to the given time and returns it's pointer.
+//
+// Parameters:
+//
+// 1. now: The initial time of the clock.
+func NewManualClock(now time.Time) *ManualClock {
+	clock := &ManualClock{now: now}
+	clock.cond = sync.NewCond(&clock.lock)
+	return clock
+}
@@ -0,0 +1,75 @@
+package ratelimiter
+
+import (
+	"testing"
+	"time"
+)
+
+func TestManualClockTimers(t *testing.T) {
+	start := time.Unix(1000, 0)
+	clock := NewManualClock(start)
+
+	timer := clock.NewTimer(time.Second)
+	stopped := clock.NewTimer(time.Second)
+
+	if !stopped.Stop() {
+		t.Fatalf("ManualClock timer Stop() returned false for an active timer")
+	}
+
+	clock.Advance(999 * time.Millisecond)
+	select {
+	case <-timer.C():
+		t.Fatalf("ManualClock timer fired before it's deadline")
+	default:
+	}
+
+	clock.Advance(time.Millisecond)
+	select {
+	case now := <-timer.C():
+		if !now.Equal(start.Add(time.Second)) {
+			t.Fatalf("ManualClock timer fired with time %v, expected %v", now, start.Add(time.Second))
+		}
+	default:
+		t.Fatalf("ManualClock timer did not fire after it's deadline")
+	}
+
+	select {
+	case <-stopped.C():
+		t.Fatalf("ManualClock timer fired after it was stopped")
+	default:
+	}
+
+	if timer.Reset(time.Second) {
+		t.Fatalf("ManualClock timer Reset() returned true for an expired timer")
+	}
+
+	clock.Set(start.Add(time.Hour))
+	select {
+	case <-timer.C():
+	default:
+		t.Fatalf("ManualClock timer did not fire after it was reset")
+	}
+
+	if !clock.Now().Equal(start.Add(time.Hour)) {
+		t.Fatalf("ManualClock Now() returned %v, expected %v", clock.Now(), start.Add(time.Hour))
+	}
+}
+
+func TestManualClockSleep(t *testing.T) {
+	clock := NewManualClock(time.Unix(1000, 0))
+
+	done := make(chan struct{})
+	go func() {
+		clock.Sleep(time.Minute)
+		close(done)
+	}()
+
+	clock.BlockUntil(1)
+	clock.Advance(time.Minute)
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("ManualClock Sleep() did not return after the clock was advanced")
+	}
+}
@@ -0,0 +1,291 @@
+package ratelimiter
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"sync"
+)
+
+// concurrencyWaiter is a goroutine blocked in Acquire.
+type concurrencyWaiter struct {
+	n     uint64
+	ready chan struct{}
+}
+
+// ConcurrencyLimiter limits the number of tasks in-flight at any point of time, unlike the rate
+// limiters the capacity taken by a task is given back only when it is released. Blocked
+// Acquire calls are served in FIFO order, so a large n is not starved by smaller ones.
+type ConcurrencyLimiter struct {
+	lock     sync.Mutex
+	limit    uint64
+	inUse    uint64
+	waiters  list.List
+	killed   bool
+	done     chan struct{}
+	notifier notifier
+}
+
+// TryAcquire acquires the capacity for n tasks without blocking.
+//
+// Parameters:
+//
+// 1. n: number of tasks to be processed.
+//
+// Returns (bool, error). (false, error) if limiter is inactive (or it is killed). Otherwise,
+// (true/false, nil) depending on whether the capacity for n tasks was acquired or not.
+func (c *ConcurrencyLimiter) TryAcquire(n uint64) (bool, error) {
+	result, err := c.allowResult(n, true)
+	return result.Allowed, err
+}
+
+// allowResult is TryAcquire, the observer is notified of the decision only if notify is true.
+func (c *ConcurrencyLimiter) allowResult(n uint64, notify bool) (Result, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.killed {
+		return Result{}, fmt.Errorf("function TryAcquire called on an inactive instance: %w", ErrLimiterKilled)
+	}
+
+	if c.limit == 0 {
+		return Result{}, ErrInvalidConfig
+	}
+
+	// tasks waiting in Acquire are served first.
+	acquired := c.waiters.Len() == 0 && c.inUse+n <= c.limit
+	if acquired {
+		c.inUse += n
+	}
+
+	if notify {
+		c.notifier.notify(n, acquired)
+	}
+	return Result{Allowed: acquired}, nil
+}
+
+// observer returns the notifier of the observer of the limiter.
+func (c *ConcurrencyLimiter) observer() notifier {
+	return c.notifier
+}
+
+// Peek reports whether the capacity for n tasks would be acquired right now by TryAcquire,
+// without acquiring it.
+//
+// Parameters:
+//
+// 1. n: number of tasks to be processed.
+//
+// Returns (bool, error). (false, error) if limiter is inactive (or it is killed). Otherwise,
+// (true/false, nil) depending on whether the capacity for n tasks would be acquired or not.
+func (c *ConcurrencyLimiter) Peek(n uint64) (bool, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.killed {
+		return false, fmt.Errorf("function Peek called on an inactive instance: %w", ErrLimiterKilled)
+	}
+
+	if c.limit == 0 {
+		return false, ErrInvalidConfig
+	}
+
+	return c.waiters.Len() == 0 && c.inUse+n <= c.limit, nil
+}
+
+// Acquire blocks until the capacity for n tasks is acquired or until ctx is done.
+//
+// Parameters:
+//
+// 1. ctx: context used to cancel the wait.
+//
+// 2. n: number of tasks to be processed, must not be greater than the limit.
+//
+// Returns nil once the capacity is acquired, ctx.Err() if ctx is done before that, or an error
+// if the limiter is inactive (or it is killed) or n can never be acquired.
+func (c *ConcurrencyLimiter) Acquire(ctx context.Context, n uint64) error {
+	c.lock.Lock()
+
+	if c.killed {
+		c.lock.Unlock()
+		return fmt.Errorf("function Acquire called on an inactive instance: %w", ErrLimiterKilled)
+	}
+
+	if c.limit == 0 {
+		c.lock.Unlock()
+		return ErrInvalidConfig
+	}
+
+	if n > c.limit {
+		c.lock.Unlock()
+		return fmt.Errorf("%w: n = %d, limit = %d", ErrExceedsLimit, n, c.limit)
+	}
+
+	if c.waiters.Len() == 0 && c.inUse+n <= c.limit {
+		c.inUse += n
+		c.lock.Unlock()
+		return nil
+	}
+
+	waiter := &concurrencyWaiter{n: n, ready: make(chan struct{})}
+	elem := c.waiters.PushBack(waiter)
+	c.lock.Unlock()
+
+	select {
+	case <-waiter.ready:
+		return nil
+	case <-c.done:
+		select {
+		case <-waiter.ready:
+			return nil
+		default:
+			return fmt.Errorf("function Acquire called on an inactive instance: %w", ErrLimiterKilled)
+		}
+	case <-ctx.Done():
+		c.lock.Lock()
+		defer c.lock.Unlock()
+
+		select {
+		case <-waiter.ready:
+			// acquired right after ctx was done, give it back.
+			c.inUse -= n
+			c.notifyWaiters()
+		default:
+			isFront := c.waiters.Front() == elem
+			c.waiters.Remove(elem)
+			// waiters behind the removed one might fit now.
+			if isFront {
+				c.notifyWaiters()
+			}
+		}
+
+		return ctx.Err()
+	}
+}
+
+// Release gives back the capacity of n tasks acquired earlier, waking up the blocked Acquire calls that fit.
+// Releasing more than what is in use is treated as releasing everything.
+//
+// Parameters:
+//
+// 1. n: number of tasks that are done.
+func (c *ConcurrencyLimiter) Release(n uint64) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if n > c.inUse {
+		n = c.inUse
+	}
+
+	c.inUse -= n
+	c.notifyWaiters()
+}
+
+// notifyWaiters hands over the capacity to the waiters in FIFO order, must be called with lock held.
+func (c *ConcurrencyLimiter) notifyWaiters() {
+	for {
+		front := c.waiters.Front()
+		if front == nil {
+			return
+		}
+
+		waiter := front.Value.(*concurrencyWaiter)
+		if c.inUse+waiter.n > c.limit {
+			return
+		}
+
+		c.inUse += waiter.n
+		c.waiters.Remove(front)
+		close(waiter.ready)
+	}
+}
+
+// InUse returns the number of tasks currently holding the capacity.
+func (c *ConcurrencyLimiter) InUse() uint64 {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.inUse
+}
+
+// ShouldAllow acquires the capacity for n tasks without blocking, same as TryAcquire. It makes
+// ConcurrencyLimiter satisfy the Limiter interface, the capacity must be given back using Release.
+//
+// Parameters:
+//
+// 1. n: number of tasks to be processed.
+//
+// Returns (bool, error). (false, error) if limiter is inactive (or it is killed). Otherwise,
+// (true/false, nil) depending on whether the capacity for n tasks was acquired or not.
+func (c *ConcurrencyLimiter) ShouldAllow(n uint64) (bool, error) {
+	return c.TryAcquire(n)
+}
+
+// SetLimit changes the maximum number of tasks in-flight, waiters that fit are woken up.
+//
+// Parameters:
+//
+// 1. limit: The maximum number of tasks in-flight.
+//
+// Returns an error if the limiter is inactive (or it is killed) or limit is 0.
+func (c *ConcurrencyLimiter) SetLimit(limit uint64) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.killed {
+		return fmt.Errorf("function SetLimit called on an inactive instance: %w", ErrLimiterKilled)
+	}
+
+	if limit == 0 {
+		return ErrInvalidConfig
+	}
+
+	c.limit = limit
+	c.notifyWaiters()
+	return nil
+}
+
+// refund gives back the capacity of n tasks acquired by ShouldAllow, same as Release.
+func (c *ConcurrencyLimiter) refund(n uint64) {
+	c.Release(n)
+}
+
+// Kill the limiter, returns error if the limiter has been killed already.
+// Blocked Acquire calls return an error.
+func (c *ConcurrencyLimiter) Kill() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.killed {
+		return fmt.Errorf("called Kill on already killed limiter: %w", ErrLimiterKilled)
+	}
+
+	c.killed = true
+	close(c.done)
+	return nil
+}
+
+// NewConcurrencyLimiter creates an instance of ConcurrencyLimiter and returns it's pointer.
+//
+// Parameters:
+//
+// 1. limit: The maximum number of tasks in-flight.
+//
+// 2. opts: optional parameters, example: WithName, WithObserver
+//
+// Returns an error if limit is 0.
+func NewConcurrencyLimiter(limit uint64, opts ...Option) (*ConcurrencyLimiter, error) {
+	if limit == 0 {
+		return nil, ErrInvalidConfig
+	}
+
+	o := newOptions(opts)
+
+	return &ConcurrencyLimiter{
+		lock:     sync.Mutex{},
+		limit:    limit,
+		killed:   false,
+		done:     make(chan struct{}),
+		notifier: o.notifier(),
+	}, nil
+}
@@ -0,0 +1,195 @@
+package ratelimiter
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestConcurrencyLimiter(t *testing.T) {
+	limiter, _ := NewConcurrencyLimiter(3)
+
+	check := func(n uint64, expected bool) {
+		acquired, err := limiter.TryAcquire(n)
+		if err != nil {
+			t.Fatalf("Error when calling TryAcquire() on active limiter, Error: %v", err)
+		}
+		if acquired != expected {
+			t.Fatalf("TryAcquire(%d) returned %v, expected %v", n, acquired, expected)
+		}
+	}
+
+	check(2, true)
+	check(2, false)
+	check(1, true)
+
+	if limiter.InUse() != 3 {
+		t.Fatalf("InUse() returned %d, expected 3", limiter.InUse())
+	}
+
+	// capacity is given back only on release, not with time:
+	limiter.Release(2)
+	check(2, true)
+	check(1, false)
+
+	if err := limiter.Acquire(context.Background(), 4); err == nil {
+		t.Fatalf("Acquire() did not return error when n exceeds the limit.")
+	}
+
+	limiter.Release(10)
+	if limiter.InUse() != 0 {
+		t.Fatalf("InUse() returned %d after releasing everything, expected 0", limiter.InUse())
+	}
+
+	limiter.Kill()
+	if _, err := limiter.TryAcquire(1); err == nil {
+		t.Fatalf("Calling TryAcquire() on inactive limiter did not throw any errors.")
+	}
+}
+
+func TestConcurrencyLimiterAcquireFIFO(t *testing.T) {
+	limiter, _ := NewConcurrencyLimiter(2)
+	limiter.TryAcquire(2)
+
+	order := make(chan uint64, 2)
+	acquire := func(n uint64) {
+		if err := limiter.Acquire(context.Background(), n); err != nil {
+			t.Errorf("Acquire(%d) returned error %v", n, err)
+		}
+		order <- n
+	}
+
+	go acquire(2)
+	waitForWaiters(t, limiter, 1)
+	go acquire(1)
+	waitForWaiters(t, limiter, 2)
+
+	// tasks behind a blocked Acquire are not allowed to overtake it:
+	if acquired, _ := limiter.TryAcquire(1); acquired {
+		t.Fatalf("TryAcquire() overtook the blocked Acquire calls")
+	}
+
+	limiter.Release(1)
+	select {
+	case n := <-order:
+		t.Fatalf("Acquire(%d) returned before the capacity for the first waiter was released", n)
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	limiter.Release(1)
+	if n := <-order; n != 2 {
+		t.Fatalf("Acquire(%d) returned first, expected Acquire(2)", n)
+	}
+
+	limiter.Release(2)
+	if n := <-order; n != 1 {
+		t.Fatalf("Acquire(%d) returned, expected Acquire(1)", n)
+	}
+}
+
+func TestConcurrencyLimiterAcquireCancel(t *testing.T) {
+	limiter, _ := NewConcurrencyLimiter(2)
+	limiter.TryAcquire(1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- limiter.Acquire(ctx, 2)
+	}()
+
+	waitForWaiters(t, limiter, 1)
+	cancel()
+
+	if err := <-done; err != context.Canceled {
+		t.Fatalf("Acquire() returned %v after ctx was cancelled, expected %v", err, context.Canceled)
+	}
+
+	// the cancelled waiter must not hold the capacity or block others:
+	if acquired, _ := limiter.TryAcquire(1); !acquired || limiter.InUse() != 2 {
+		t.Fatalf("TryAcquire() failed after the waiter was cancelled, in use %d", limiter.InUse())
+	}
+
+	go func() {
+		done <- limiter.Acquire(context.Background(), 1)
+	}()
+
+	waitForWaiters(t, limiter, 1)
+	limiter.Kill()
+
+	if err := <-done; err == nil {
+		t.Fatalf("Acquire() blocked on a killed limiter did not return error")
+	}
+}
+
+func TestAttributeBasedLimiterConcurrency(t *testing.T) {
+	attributeLimiter := NewAttributeBasedLimiter(false)
+	key := "/api/upload"
+
+	if _, err := attributeLimiter.TryAcquire(key, 1); err == nil {
+		t.Fatalf("TryAcquire() did not return error for non-existing key %s", key)
+	}
+
+	if err := attributeLimiter.CreateConcurrencyKey(key, 1); err != nil {
+		t.Fatalf("CreateConcurrencyKey() returned error %v", err)
+	}
+
+	if err := attributeLimiter.CreateConcurrencyKey(key, 1); err == nil {
+		t.Fatalf("CreateConcurrencyKey() did not return error when creating existing key %s", key)
+	}
+
+	// the rate limiter of the key is independent of the concurrency limiter:
+	if err := attributeLimiter.CreateNewKey(key, 10, time.Second); err != nil {
+		t.Fatalf("CreateNewKey() returned error %v", err)
+	}
+
+	if acquired, err := attributeLimiter.TryAcquire(key, 1); !acquired || err != nil {
+		t.Fatalf("TryAcquire() returned (%v, %v), expected (true, nil)", acquired, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := attributeLimiter.Acquire(ctx, key, 1); err != context.DeadlineExceeded {
+		t.Fatalf("Acquire() returned %v, expected %v", err, context.DeadlineExceeded)
+	}
+
+	if err := attributeLimiter.Release(key, 1); err != nil {
+		t.Fatalf("Release() returned error %v", err)
+	}
+
+	if err := attributeLimiter.Acquire(context.Background(), key, 1); err != nil {
+		t.Fatalf("Acquire() returned error %v after release", err)
+	}
+
+	if err := attributeLimiter.DeleteKey(key); err != nil {
+		t.Fatalf("DeleteKey() returned error %v", err)
+	}
+
+	if err := attributeLimiter.Release(key, 1); err == nil {
+		t.Fatalf("Release() did not return error for deleted key %s", key)
+	}
+}
+
+// waitForWaiters waits until n Acquire calls are blocked on the limiter.
+func waitForWaiters(t *testing.T, limiter *ConcurrencyLimiter, n int) {
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		limiter.lock.Lock()
+		waiting := limiter.waiters.Len()
+		limiter.lock.Unlock()
+
+		if waiting >= n {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	t.Fatalf("timed out waiting for %d blocked Acquire calls", n)
+}
+
+func BenchmarkConcurrencyLimiter(b *testing.B) {
+	limiter, _ := NewConcurrencyLimiter(100)
+	for i := 0; i < b.N; i++ {
+		limiter.TryAcquire(1)
+		limiter.Release(1)
+	}
+}
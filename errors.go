@@ -0,0 +1,25 @@
+package ratelimiter
+
+import (
+	"errors"
+)
+
+var (
+	// ErrLimiterKilled is returned when a limiter is used after it has been killed.
+	ErrLimiterKilled = errors.New("limiter is killed")
+	// ErrInvalidConfig is returned when a limiter is used or configured with a limit of 0
+	// or a window size less than a millisecond.
+	ErrInvalidConfig = errors.New("invalid limiter configuration")
+	// ErrKeyNotFound is returned by AttributeBasedLimiter and HierarchicalLimiter for unknown keys.
+	ErrKeyNotFound = errors.New("key not found")
+	// ErrKeyExists is returned by AttributeBasedLimiter and HierarchicalLimiter when a key is created twice.
+	ErrKeyExists = errors.New("key is already defined")
+	// ErrTooManyKeys is returned by AttributeBasedLimiter when a key can't be created because of WithMaxKeys.
+	ErrTooManyKeys = errors.New("too many keys")
+	// ErrPolicyNotFound is returned by AttributeBasedLimiter when a key is created from an unknown policy.
+	ErrPolicyNotFound = errors.New("policy not found")
+	// ErrExceedsLimit is returned by Wait and Acquire when more tasks are waited for at once than the limit allows.
+	ErrExceedsLimit = errors.New("n exceeds the limit")
+	// ErrNotSupported is returned by AttributeBasedLimiter when the limiter of a key doesn't support an operation.
+	ErrNotSupported = errors.New("operation not supported by the limiter")
+)
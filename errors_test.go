@@ -0,0 +1,112 @@
+package ratelimiter
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLimiterErrors(t *testing.T) {
+	defaultLimiter, _ := NewDefaultLimiter(10, time.Second)
+	syncLimiter, _ := NewSyncLimiter(10, time.Second)
+	tokenBucketLimiter, _ := NewTokenBucketLimiter(10, time.Second)
+	gcraLimiter, _ := NewGCRALimiter(10, time.Second)
+	slidingLogLimiter, _ := NewSlidingLogLimiter(10, time.Second)
+	fixedWindowLimiter, _ := NewFixedWindowLimiter(10, time.Second)
+	concurrencyLimiter, _ := NewConcurrencyLimiter(10)
+
+	limiters := []Limiter{
+		defaultLimiter, syncLimiter, tokenBucketLimiter, gcraLimiter,
+		slidingLogLimiter, fixedWindowLimiter, concurrencyLimiter,
+	}
+
+	for _, limiter := range limiters {
+		if cl, ok := limiter.(interface{ SetLimit(uint64) error }); ok {
+			if err := cl.SetLimit(0); !errors.Is(err, ErrInvalidConfig) {
+				t.Fatalf("SetLimit(0) on %T returned %v, expected %v", limiter, err, ErrInvalidConfig)
+			}
+		}
+
+		limiter.Kill()
+
+		if _, err := limiter.ShouldAllow(1); !errors.Is(err, ErrLimiterKilled) {
+			t.Fatalf("ShouldAllow() on killed %T returned %v, expected %v", limiter, err, ErrLimiterKilled)
+		}
+
+		if err := limiter.Kill(); !errors.Is(err, ErrLimiterKilled) {
+			t.Fatalf("Kill() on killed %T returned %v, expected %v", limiter, err, ErrLimiterKilled)
+		}
+	}
+
+	syncLimiter, _ = NewSyncLimiter(10, time.Second)
+	concurrencyLimiter, _ = NewConcurrencyLimiter(10)
+	if err := syncLimiter.Wait(context.Background(), 11); !errors.Is(err, ErrExceedsLimit) {
+		t.Fatalf("Wait() with n > limit returned %v, expected %v", err, ErrExceedsLimit)
+	}
+
+	if err := concurrencyLimiter.Acquire(context.Background(), 11); !errors.Is(err, ErrExceedsLimit) {
+		t.Fatalf("Acquire() with n > limit returned %v, expected %v", err, ErrExceedsLimit)
+	}
+
+	if _, err := NewSyncLimiter(0, time.Second); !errors.Is(err, ErrInvalidConfig) {
+		t.Fatalf("NewSyncLimiter() with limit 0 returned %v, expected %v", err, ErrInvalidConfig)
+	}
+
+	if _, err := NewDefaultLimiter(10, time.Microsecond); !errors.Is(err, ErrInvalidConfig) {
+		t.Fatalf("NewDefaultLimiter() with size < 1 millisecond returned %v, expected %v", err, ErrInvalidConfig)
+	}
+}
+
+func TestAttributeBasedLimiterErrors(t *testing.T) {
+	attributeLimiter := NewAttributeBasedLimiter(false)
+
+	if _, err := attributeLimiter.ShouldAllow("key", 1); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("ShouldAllow() on non-existing key returned %v, expected %v", err, ErrKeyNotFound)
+	}
+
+	if err := attributeLimiter.DeleteKey("key"); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("DeleteKey() on non-existing key returned %v, expected %v", err, ErrKeyNotFound)
+	}
+
+	attributeLimiter.CreateNewKey("key", 10, time.Second)
+	if err := attributeLimiter.CreateNewKey("key", 10, time.Second); !errors.Is(err, ErrKeyExists) {
+		t.Fatalf("CreateNewKey() on existing key returned %v, expected %v", err, ErrKeyExists)
+	}
+
+	if err := attributeLimiter.UpdateKey("key", 0, time.Second); !errors.Is(err, ErrInvalidConfig) {
+		t.Fatalf("UpdateKey() with limit 0 returned %v, expected %v", err, ErrInvalidConfig)
+	}
+
+	attributeLimiter.AddLimiter("custom", &countingLimiter{limit: 10})
+	if _, err := attributeLimiter.Peek("custom", 1); !errors.Is(err, ErrNotSupported) {
+		t.Fatalf("Peek() on a limiter that can't peek returned %v, expected %v", err, ErrNotSupported)
+	}
+
+	if err := attributeLimiter.UpdateKey("custom", 10, time.Second); !errors.Is(err, ErrNotSupported) {
+		t.Fatalf("UpdateKey() on a limiter that can't be reconfigured returned %v, expected %v", err, ErrNotSupported)
+	}
+
+	// keys whose limiter was already killed can be deleted:
+	killed, _ := NewSyncLimiter(10, time.Second)
+	attributeLimiter.AddLimiter("killed", killed)
+	attributeLimiter.CreateConcurrencyKey("killed", 10)
+	killed.Kill()
+
+	if err := attributeLimiter.DeleteKey("killed"); err != nil {
+		t.Fatalf("DeleteKey() returned %v for a key whose limiter was already killed", err)
+	}
+
+	if attributeLimiter.HasKey("killed") {
+		t.Fatalf("DeleteKey() left the key whose limiter was already killed")
+	}
+
+	if _, err := attributeLimiter.TryAcquire("killed", 1); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("DeleteKey() left the concurrency limiter of the key, TryAcquire() returned %v", err)
+	}
+
+	hierarchicalLimiter := NewHierarchicalLimiter(false)
+	if err := hierarchicalLimiter.CreateNewKey("user", "org", 10, time.Second); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("CreateNewKey() with non-existing parent returned %v, expected %v", err, ErrKeyNotFound)
+	}
+}
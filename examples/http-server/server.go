@@ -31,7 +31,10 @@ func main() {
 	}
 
 	// add a middleware:
-	limiter := ratelimiter.NewSyncLimiter(requestsAllowed, duration)
+	limiter, err := ratelimiter.NewSyncLimiter(requestsAllowed, duration)
+	if err != nil {
+		log.Fatalln(err)
+	}
 
 	rateLimiterHandler := func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -61,7 +64,7 @@ func main() {
 
 	// start reporter routine:
 	go reporter()
-	err := http.ListenAndServe(":6000", muxServer)
+	err = http.ListenAndServe(":6000", muxServer)
 	if err != nil {
 		log.Fatalln(err)
 	}
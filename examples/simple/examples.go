@@ -11,18 +11,23 @@ import (
 
 func GenericRateLimiter() {
 	/* create an instance of Limiter.
-	format: NewLimiter(limit uint64, size time.Duration),
+	format: NewLimiter(limit uint64, size time.Duration, opts ...Option) (Limiter, error),
 	where:
 		limit: The number of tasks/items that should be allowed.
 		size: The window size, i.e the time interval during which the limit
 				should be imposed.
 		To summarize, if limit = 100 and duration = 5s, then allow 100 items per 5 seconds
+		An error is returned if limit is 0 or size is less than a millisecond.
 	*/
 
-	limiter := ratelimiter.NewSyncLimiter(
+	limiter, err := ratelimiter.NewSyncLimiter(
 		100, time.Second*5,
 	)
 
+	if err != nil {
+		log.Fatalln(err)
+	}
+
 	/*
 		Cleaning up the limiter: Once the limiter is no longer required,
 		the underlying goroutines and resources used by the limiter can be cleaned up.
@@ -0,0 +1,331 @@
+package ratelimiter
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// CalendarPeriod is a calendar aligned window used by FixedWindowLimiter, unlike a window size
+// it follows the calendar of the location, i.e days start at midnight and months on the first.
+type CalendarPeriod int
+
+const (
+	// Daily windows start at midnight.
+	Daily CalendarPeriod = iota + 1
+	// Monthly windows start at midnight of the first day of the month.
+	Monthly
+)
+
+// FixedWindowLimiter allows limit tasks per window, the windows are aligned to multiples of the
+// window size (or to calendar periods) and the count is reset at every window boundary. It is
+// cheaper than a sliding window and easier to explain for coarse quotas like 10k tasks per day.
+type FixedWindowLimiter struct {
+	window   *Window
+	lock     sync.Mutex
+	size     time.Duration
+	period   CalendarPeriod
+	location *time.Location
+	limit    uint64
+	killed   bool
+	clock    Clock
+	notifier notifier
+}
+
+// bounds returns the start and end of the window containing now.
+func (f *FixedWindowLimiter) bounds(now time.Time) (time.Time, time.Time) {
+	local := now.In(f.location)
+
+	switch f.period {
+	case Daily:
+		start := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, f.location)
+		return start, start.AddDate(0, 0, 1)
+	case Monthly:
+		start := time.Date(local.Year(), local.Month(), 1, 0, 0, 0, 0, f.location)
+		return start, start.AddDate(0, 1, 0)
+	}
+
+	// align to the multiples of size in the wall clock of the location.
+	_, offset := local.Zone()
+	zoneOffset := time.Duration(offset) * time.Second
+
+	start := now.Add(zoneOffset).Truncate(f.size).Add(-zoneOffset)
+	return start, start.Add(f.size)
+}
+
+// advance resets the window if now is past it.
+func (f *FixedWindowLimiter) advance(now time.Time) time.Time {
+	start, end := f.bounds(now)
+	if !start.Equal(f.window.getStartTime()) {
+		f.window.resetToTime(start)
+	}
+
+	return end
+}
+
+func (f *FixedWindowLimiter) validate(fnName string) error {
+	if f.killed {
+		return fmt.Errorf("function %s called on an inactive instance: %w", fnName, ErrLimiterKilled)
+	}
+
+	validWindow := f.period == Daily || f.period == Monthly || (f.period == 0 && f.size >= time.Millisecond)
+	if f.limit == 0 || !validWindow || f.location == nil {
+		return ErrInvalidConfig
+	}
+
+	return nil
+}
+
+// ShouldAllow makes decison whether n tasks can be allowed or not.
+//
+// Parameters:
+//
+// 1. n: number of tasks to be processed, set this as 1 for a single task. (Example: An HTTP request)
+//
+// Returns (bool, error). (false, error) if limiter is inactive (or it is killed). Otherwise,
+// (true/false, nil) depending on whether n tasks can be allowed or not.
+func (f *FixedWindowLimiter) ShouldAllow(n uint64) (bool, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if err := f.validate("ShouldAllow"); err != nil {
+		return false, err
+	}
+
+	f.advance(f.clock.Now())
+
+	allowed := f.window.count+n <= f.limit
+	if allowed {
+		f.window.updateCount(n)
+	}
+
+	f.notifier.notify(n, allowed)
+	return allowed, nil
+}
+
+// Peek reports whether n tasks would be allowed right now, without counting them.
+//
+// Parameters:
+//
+// 1. n: number of tasks to be processed, set this as 1 for a single task. (Example: An HTTP request)
+//
+// Returns (bool, error). (false, error) if limiter is inactive (or it is killed). Otherwise,
+// (true/false, nil) depending on whether n tasks would be allowed or not.
+func (f *FixedWindowLimiter) Peek(n uint64) (bool, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if err := f.validate("Peek"); err != nil {
+		return false, err
+	}
+
+	count := f.window.count
+	if start, _ := f.bounds(f.clock.Now()); !start.Equal(f.window.getStartTime()) {
+		count = 0
+	}
+
+	return count+n <= f.limit, nil
+}
+
+// inspect describes the state of the limiter, the windows are not sliding, so the usage is the
+// number of tasks counted in the current window.
+func (f *FixedWindowLimiter) inspect() KeyInfo {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	info := KeyInfo{Limit: f.limit}
+	start, end := f.bounds(f.clock.Now())
+	info.Size = end.Sub(start)
+
+	if start.Equal(f.window.getStartTime()) {
+		info.Current = f.window.count
+		info.Usage = f.window.count
+	}
+
+	return info
+}
+
+// Allow makes decison whether n tasks can be allowed or not, just like ShouldAllow,
+// and describes the state of the limiter after the decision.
+//
+// Parameters:
+//
+// 1. n: number of tasks to be processed, set this as 1 for a single task. (Example: An HTTP request)
+//
+// Returns (Result, error). (Result{}, error) if limiter is inactive (or it is killed). Otherwise,
+// (Result, nil) where Result.Allowed is true/false depending on whether n tasks can be allowed or not.
+func (f *FixedWindowLimiter) Allow(n uint64) (Result, error) {
+	return f.allowResult(n, true)
+}
+
+// allowResult is Allow, the observer is notified of the decision only if notify is true.
+func (f *FixedWindowLimiter) allowResult(n uint64, notify bool) (Result, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if err := f.validate("Allow"); err != nil {
+		return Result{}, err
+	}
+
+	currentTime := f.clock.Now()
+	end := f.advance(currentTime)
+
+	allowed := f.window.count+n <= f.limit
+	if allowed {
+		f.window.updateCount(n)
+	}
+
+	if notify {
+		f.notifier.notify(n, allowed)
+	}
+	result := Result{
+		Allowed: allowed,
+		Limit:   f.limit,
+		ResetAt: end,
+	}
+
+	if f.window.count < f.limit {
+		result.Remaining = f.limit - f.window.count
+	}
+
+	if !allowed && n <= f.limit {
+		result.RetryAfter = end.Sub(currentTime)
+	}
+
+	return result, nil
+}
+
+// observer returns the notifier of the observer of the limiter.
+func (f *FixedWindowLimiter) observer() notifier {
+	return f.notifier
+}
+
+// SetLimit changes the number of tasks to be allowed per window, the tasks already counted are retained.
+//
+// Parameters:
+//
+// 1. limit: The number of tasks to be allowd
+//
+// Returns an error if the limiter is inactive (or it is killed) or limit is 0.
+func (f *FixedWindowLimiter) SetLimit(limit uint64) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if f.killed {
+		return fmt.Errorf("function SetLimit called on an inactive instance: %w", ErrLimiterKilled)
+	}
+
+	if limit == 0 {
+		return ErrInvalidConfig
+	}
+
+	f.limit = limit
+	return nil
+}
+
+// SetSize changes the window size, calendar aligned limiters switch to windows of the given size.
+// The count of the current window is reset if it's boundaries change.
+//
+// Parameters:
+//
+// 1. size: duration
+//
+// Returns an error if the limiter is inactive (or it is killed) or size is less than a millisecond.
+func (f *FixedWindowLimiter) SetSize(size time.Duration) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if f.killed {
+		return fmt.Errorf("function SetSize called on an inactive instance: %w", ErrLimiterKilled)
+	}
+
+	if size < time.Millisecond {
+		return ErrInvalidConfig
+	}
+
+	f.size = size
+	f.period = 0
+	return nil
+}
+
+// refund gives back n tasks counted by ShouldAllow or Allow moments ago, if the window
+// has been reset since then there is nothing to give back.
+func (f *FixedWindowLimiter) refund(n uint64) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if f.window.count < n {
+		n = f.window.count
+	}
+
+	f.window.count -= n
+}
+
+// Kill the limiter, returns error if the limiter has been killed already.
+func (f *FixedWindowLimiter) Kill() error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if f.killed {
+		return fmt.Errorf("called Kill on already killed limiter: %w", ErrLimiterKilled)
+	}
+
+	f.killed = true
+	return nil
+}
+
+// NewFixedWindowLimiter creates an instance of FixedWindowLimiter and returns it's pointer.
+// Windows are aligned to the multiples of size, in the wall clock of the location set by
+// WithLocation (UTC by default).
+//
+// Parameters:
+//
+// 1. limit: The number of tasks to be allowd
+//
+// 2. size: duration
+//
+// 3. opts: optional parameters, example: WithClock, WithLocation, WithName, WithObserver
+//
+// Returns an error if limit is 0, size is less than a millisecond or the location is nil.
+func NewFixedWindowLimiter(limit uint64, size time.Duration, opts ...Option) (*FixedWindowLimiter, error) {
+	return newFixedWindowLimiter(limit, size, 0, opts)
+}
+
+func newFixedWindowLimiter(limit uint64, size time.Duration, period CalendarPeriod, opts []Option) (*FixedWindowLimiter, error) {
+	o := newOptions(opts)
+
+	limiter := &FixedWindowLimiter{
+		window:   NewWindow(0, time.Unix(0, 0)),
+		lock:     sync.Mutex{},
+		size:     size,
+		period:   period,
+		location: o.location,
+		limit:    limit,
+		killed:   false,
+		clock:    o.clock,
+		notifier: o.notifier(),
+	}
+
+	if err := limiter.validate("NewFixedWindowLimiter"); err != nil {
+		return nil, err
+	}
+
+	return limiter, nil
+}
+
+// NewCalendarLimiter creates an instance of FixedWindowLimiter with calendar aligned windows
+// and returns it's pointer. Example: 10k tasks per day, reset at midnight in the location set
+// by WithLocation (UTC by default).
+//
+// Parameters:
+//
+// 1. limit: The number of tasks to be allowd
+//
+// 2. period: Daily or Monthly
+//
+// 3. opts: optional parameters, example: WithClock, WithLocation, WithName, WithObserver
+//
+// Returns an error if limit is 0, period is neither Daily nor Monthly or the location is nil.
+func NewCalendarLimiter(limit uint64, period CalendarPeriod, opts ...Option) (*FixedWindowLimiter, error) {
+	return newFixedWindowLimiter(limit, 0, period, opts)
+}
@@ -0,0 +1,117 @@
+package ratelimiter
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestFixedWindowLimiter(t *testing.T) {
+	clock := NewManualClock(time.Date(2021, 10, 5, 14, 0, 30, 0, time.UTC))
+	limiter, _ := NewFixedWindowLimiter(10, time.Minute, WithClock(clock))
+
+	check := func(n uint64, expected bool) {
+		allowed, err := limiter.ShouldAllow(n)
+		if err != nil {
+			t.Fatalf("Error when calling ShouldAllow() on active limiter, Error: %v", err)
+		}
+		if allowed != expected {
+			t.Fatalf("ShouldAllow(%d) returned %v, expected %v", n, allowed, expected)
+		}
+	}
+
+	check(10, true)
+	check(1, false)
+
+	result, err := limiter.Allow(1)
+	if err != nil {
+		t.Fatalf("Error when calling Allow() on active limiter, Error: %v", err)
+	}
+
+	// the window is aligned to the minute:
+	if result.Allowed || result.RetryAfter != 30*time.Second || !result.ResetAt.Equal(clock.Now().Add(30*time.Second)) {
+		t.Fatalf("Allow() returned unexpected result %+v", result)
+	}
+
+	// the count is reset at the window boundary:
+	clock.Advance(30 * time.Second)
+	check(10, true)
+	check(1, false)
+
+	limiter.Kill()
+	if _, err := limiter.ShouldAllow(1); err == nil {
+		t.Fatalf("Calling ShouldAllow() on inactive limiter did not throw any errors.")
+	}
+}
+
+func TestCalendarLimiter(t *testing.T) {
+	location := time.FixedZone("UTC+5:30", 5*3600+1800)
+
+	// 23:00 in the location.
+	clock := NewManualClock(time.Date(2021, 1, 31, 23, 0, 0, 0, location))
+
+	daily, _ := NewCalendarLimiter(100, Daily, WithClock(clock), WithLocation(location))
+	monthly, _ := NewCalendarLimiter(1000, Monthly, WithClock(clock), WithLocation(location))
+
+	result, _ := daily.Allow(100)
+	if !result.Allowed || !result.ResetAt.Equal(time.Date(2021, 2, 1, 0, 0, 0, 0, location)) {
+		t.Fatalf("Allow() on daily limiter returned unexpected result %+v", result)
+	}
+
+	result, _ = monthly.Allow(1000)
+	if !result.Allowed || !result.ResetAt.Equal(time.Date(2021, 2, 1, 0, 0, 0, 0, location)) {
+		t.Fatalf("Allow() on monthly limiter returned unexpected result %+v", result)
+	}
+
+	// midnight in the location, both windows are reset:
+	clock.Advance(time.Hour)
+	if allowed, _ := daily.ShouldAllow(100); !allowed {
+		t.Fatalf("ShouldAllow() on daily limiter did not reset at midnight")
+	}
+
+	result, _ = monthly.Allow(1000)
+	if !result.Allowed || !result.ResetAt.Equal(time.Date(2021, 3, 1, 0, 0, 0, 0, location)) {
+		t.Fatalf("Allow() on monthly limiter returned unexpected result %+v", result)
+	}
+
+	// the monthly window lasts until the first of the next month:
+	clock.Advance(27 * 24 * time.Hour)
+	if allowed, _ := monthly.ShouldAllow(1); allowed {
+		t.Fatalf("ShouldAllow() on monthly limiter reset before the end of the month")
+	}
+
+	if allowed, _ := daily.ShouldAllow(100); !allowed {
+		t.Fatalf("ShouldAllow() on daily limiter did not reset at midnight")
+	}
+
+	if _, err := NewCalendarLimiter(10, CalendarPeriod(10)); err == nil {
+		t.Fatalf("NewCalendarLimiter() failed, did not throw error for invalid calendar period")
+	}
+}
+
+func TestFixedWindowInvalidConfiguration(t *testing.T) {
+	if _, err := NewFixedWindowLimiter(0, time.Second); !errors.Is(err, ErrInvalidConfig) {
+		t.Fatalf("NewFixedWindowLimiter() returned %v when limit == 0, expected %v", err, ErrInvalidConfig)
+	}
+
+	if _, err := NewFixedWindowLimiter(10, time.Second, WithLocation(nil)); !errors.Is(err, ErrInvalidConfig) {
+		t.Fatalf("NewFixedWindowLimiter() returned %v for nil location, expected %v", err, ErrInvalidConfig)
+	}
+
+	if _, err := NewCalendarLimiter(10, Daily, WithLocation(nil)); !errors.Is(err, ErrInvalidConfig) {
+		t.Fatalf("NewCalendarLimiter() returned %v for nil location, expected %v", err, ErrInvalidConfig)
+	}
+}
+
+func TestAttributeBasedFixedWindow(t *testing.T) {
+	attributeLimiter := NewAttributeBasedLimiter(false, WithLimiterType(FixedWindow))
+
+	if !attributeLimiter.MustShouldAllow("key", 10, 10, time.Hour) {
+		t.Fatalf("AttributeBasedLimiter.MustShouldAllow() failed to allow tasks within the limit")
+	}
+
+	limiter, _ := attributeLimiter.getLimiter("key")
+	if _, ok := limiter.(*FixedWindowLimiter); !ok {
+		t.Fatalf("AttributeBasedLimiter did not create a FixedWindowLimiter for the key")
+	}
+}
@@ -0,0 +1,344 @@
+package ratelimiter
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// GCRALimiter implements the generic cell rate algorithm, it allows limit tasks per window
+// of given size evenly spaced, with bursts of up to burst tasks. The only state kept is the
+// theoretical arrival time of the next task, which makes it suitable to be used for a large
+// number of keys.
+type GCRALimiter struct {
+	lock  sync.Mutex
+	tat   int64
+	limit uint64
+	size  time.Duration
+	burst uint64
+	// burstIsLimit is true when the burst was not set by WithBurst, it then follows the limit.
+	burstIsLimit bool
+	killed       bool
+	clock        Clock
+	notifier     notifier
+}
+
+// emissionInterval returns the time between two evenly spaced tasks.
+func (g *GCRALimiter) emissionInterval() int64 {
+	return int64(g.size) / int64(g.limit)
+}
+
+// validGCRAConfig reports whether limit tasks with bursts of burst tasks can be evenly spaced in size.
+func validGCRAConfig(limit uint64, size time.Duration, burst uint64) bool {
+	return limit != 0 && burst != 0 && size >= time.Millisecond && int64(size)/int64(limit) != 0
+}
+
+// burstFor returns the burst the limiter would have with the given limit.
+func (g *GCRALimiter) burstFor(limit uint64) uint64 {
+	if g.burstIsLimit {
+		return limit
+	}
+
+	return g.burst
+}
+
+func (g *GCRALimiter) validate(fnName string) error {
+	if g.killed {
+		return fmt.Errorf("function %s called on an inactive instance: %w", fnName, ErrLimiterKilled)
+	}
+
+	if !validGCRAConfig(g.limit, g.size, g.burst) {
+		return ErrInvalidConfig
+	}
+
+	return nil
+}
+
+// conform returns the theoretical arrival time after n tasks at now, along with the
+// duration after which the tasks could be allowed, which is zero if they conform.
+func (g *GCRALimiter) conform(now int64, n uint64) (int64, time.Duration) {
+	interval := g.emissionInterval()
+
+	tat := g.tat
+	if tat < now {
+		tat = now
+	}
+
+	newTat := tat + int64(n)*interval
+	allowAt := newTat - int64(g.burst)*interval
+
+	if allowAt > now {
+		return newTat, time.Duration(allowAt - now)
+	}
+
+	return newTat, 0
+}
+
+// allow checks and counts n tasks at now, returns the decision along with
+// the duration after which the tasks could be allowed if they were not.
+func (g *GCRALimiter) allow(now int64, n uint64) (bool, time.Duration) {
+	newTat, retryAfter := g.conform(now, n)
+	if retryAfter > 0 {
+		return false, retryAfter
+	}
+
+	g.tat = newTat
+	return true, 0
+}
+
+// ShouldAllow makes decison whether n tasks can be allowed or not.
+//
+// Parameters:
+//
+// 1. n: number of tasks to be processed, set this as 1 for a single task. (Example: An HTTP request)
+//
+// Returns (bool, error). (false, error) if limiter is inactive (or it is killed). Otherwise,
+// (true/false, nil) depending on whether n tasks can be allowed or not.
+func (g *GCRALimiter) ShouldAllow(n uint64) (bool, error) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	if err := g.validate("ShouldAllow"); err != nil {
+		return false, err
+	}
+
+	allowed, _ := g.allow(g.clock.Now().UnixNano(), n)
+	g.notifier.notify(n, allowed)
+	return allowed, nil
+}
+
+// Peek reports whether n tasks would be allowed right now, without counting them.
+//
+// Parameters:
+//
+// 1. n: number of tasks to be processed, set this as 1 for a single task. (Example: An HTTP request)
+//
+// Returns (bool, error). (false, error) if limiter is inactive (or it is killed). Otherwise,
+// (true/false, nil) depending on whether n tasks would be allowed or not.
+func (g *GCRALimiter) Peek(n uint64) (bool, error) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	if err := g.validate("Peek"); err != nil {
+		return false, err
+	}
+
+	_, retryAfter := g.conform(g.clock.Now().UnixNano(), n)
+	return retryAfter == 0, nil
+}
+
+// inspect describes the state of the limiter, the usage is the number of emission intervals
+// the theoretical arrival time is ahead of now.
+func (g *GCRALimiter) inspect() KeyInfo {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	info := KeyInfo{Limit: g.limit, Size: g.size}
+	if g.limit == 0 {
+		return info
+	}
+
+	interval := g.emissionInterval()
+	if ahead := g.tat - g.clock.Now().UnixNano(); ahead > 0 && interval > 0 {
+		info.Usage = uint64((ahead + interval - 1) / interval)
+	}
+
+	return info
+}
+
+// Allow makes decison whether n tasks can be allowed or not, just like ShouldAllow,
+// and describes the state of the limiter after the decision. Limit is the burst
+// and ResetAt is the time at which the full burst will be available again.
+//
+// Parameters:
+//
+// 1. n: number of tasks to be processed, set this as 1 for a single task. (Example: An HTTP request)
+//
+// Returns (Result, error). (Result{}, error) if limiter is inactive (or it is killed). Otherwise,
+// (Result, nil) where Result.Allowed is true/false depending on whether n tasks can be allowed or not.
+func (g *GCRALimiter) Allow(n uint64) (Result, error) {
+	return g.allowResult(n, true)
+}
+
+// allowResult is Allow, the observer is notified of the decision only if notify is true.
+func (g *GCRALimiter) allowResult(n uint64, notify bool) (Result, error) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	if err := g.validate("Allow"); err != nil {
+		return Result{}, err
+	}
+
+	currentTime := g.clock.Now()
+	now := currentTime.UnixNano()
+
+	allowed, retryAfter := g.allow(now, n)
+	if notify {
+		g.notifier.notify(n, allowed)
+	}
+
+	result := Result{
+		Allowed: allowed,
+		Limit:   g.burst,
+		ResetAt: currentTime,
+	}
+
+	if !allowed && n <= g.burst {
+		result.RetryAfter = retryAfter
+	}
+
+	if g.tat > now {
+		result.ResetAt = currentTime.Add(time.Duration(g.tat - now))
+	}
+
+	// the unused part of the burst tolerance, partially elapsed intervals are counted as used.
+	interval := g.emissionInterval()
+	if interval == 0 {
+		return result, nil
+	}
+
+	if used := uint64((int64(result.ResetAt.Sub(currentTime)) + interval - 1) / interval); used < g.burst {
+		result.Remaining = g.burst - used
+	}
+
+	return result, nil
+}
+
+// observer returns the notifier of the observer of the limiter.
+func (g *GCRALimiter) observer() notifier {
+	return g.notifier
+}
+
+// SetLimit changes the number of tasks to be allowed per window.
+//
+// Parameters:
+//
+// 1. limit: The number of tasks to be allowd
+//
+// Returns an error if the limiter is inactive (or it is killed), limit is 0 or
+// limit tasks can't be evenly spaced in the window, the limit is left unchanged then.
+// The burst is changed along with the limit unless it was set using WithBurst.
+func (g *GCRALimiter) SetLimit(limit uint64) error {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	if g.killed {
+		return fmt.Errorf("function SetLimit called on an inactive instance: %w", ErrLimiterKilled)
+	}
+
+	if !validGCRAConfig(limit, g.size, g.burstFor(limit)) {
+		return ErrInvalidConfig
+	}
+
+	g.limit = limit
+	g.burst = g.burstFor(limit)
+	return nil
+}
+
+// SetSize changes the window size.
+//
+// Parameters:
+//
+// 1. size: duration
+//
+// Returns an error if the limiter is inactive (or it is killed), size is less than a millisecond or
+// the limit can't be evenly spaced in it, the size is left unchanged then.
+func (g *GCRALimiter) SetSize(size time.Duration) error {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	if g.killed {
+		return fmt.Errorf("function SetSize called on an inactive instance: %w", ErrLimiterKilled)
+	}
+
+	if !validGCRAConfig(g.limit, size, g.burst) {
+		return ErrInvalidConfig
+	}
+
+	g.size = size
+	return nil
+}
+
+// configure changes both the limit and the window size, they are left unchanged if the
+// configuration is invalid.
+func (g *GCRALimiter) configure(limit uint64, size time.Duration) error {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	if g.killed {
+		return fmt.Errorf("function configure called on an inactive instance: %w", ErrLimiterKilled)
+	}
+
+	if !validGCRAConfig(limit, size, g.burstFor(limit)) {
+		return ErrInvalidConfig
+	}
+
+	g.limit = limit
+	g.burst = g.burstFor(limit)
+	g.size = size
+	return nil
+}
+
+// refund moves the theoretical arrival time back by n tasks counted by ShouldAllow or Allow moments ago.
+func (g *GCRALimiter) refund(n uint64) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	if g.limit == 0 {
+		return
+	}
+
+	g.tat -= int64(n) * g.emissionInterval()
+}
+
+// Kill the limiter, returns error if the limiter has been killed already.
+func (g *GCRALimiter) Kill() error {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	if g.killed {
+		return fmt.Errorf("called Kill on already killed limiter: %w", ErrLimiterKilled)
+	}
+
+	g.killed = true
+	return nil
+}
+
+// NewGCRALimiter creates an instance of GCRALimiter and returns it's pointer, bursts of up to
+// limit tasks are allowed unless WithBurst is used.
+//
+// Parameters:
+//
+// 1. limit: The number of tasks to be allowd
+//
+// 2. size: duration
+//
+// 3. opts: optional parameters, example: WithBurst, WithClock, WithName, WithObserver
+//
+// Returns an error if limit or burst is 0, size is less than a millisecond or
+// limit tasks can't be evenly spaced in size.
+func NewGCRALimiter(limit uint64, size time.Duration, opts ...Option) (*GCRALimiter, error) {
+	o := newOptions(opts)
+
+	burst := o.burst
+	if burst == 0 {
+		burst = limit
+	}
+
+	limiter := &GCRALimiter{
+		lock:         sync.Mutex{},
+		limit:        limit,
+		size:         size,
+		burst:        burst,
+		burstIsLimit: o.burst == 0,
+		killed:       false,
+		clock:        o.clock,
+		notifier:     o.notifier(),
+	}
+
+	if err := limiter.validate("NewGCRALimiter"); err != nil {
+		return nil, err
+	}
+
+	return limiter, nil
+}
@@ -0,0 +1,165 @@
+package ratelimiter
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestGCRALimiter(t *testing.T) {
+	clock := NewManualClock(time.Unix(1000, 0))
+
+	// 10 tasks per second, i.e one task every 100ms, with bursts of up to 5 tasks.
+	limiter, _ := NewGCRALimiter(10, time.Second, WithBurst(5), WithClock(clock))
+
+	check := func(n uint64, expected bool) {
+		allowed, err := limiter.ShouldAllow(n)
+		if err != nil {
+			t.Fatalf("Error when calling ShouldAllow() on active limiter, Error: %v", err)
+		}
+		if allowed != expected {
+			t.Fatalf("ShouldAllow(%d) returned %v, expected %v", n, allowed, expected)
+		}
+	}
+
+	check(5, true)
+	check(1, false)
+
+	// a single task is allowed after every emission interval:
+	for i := 0; i < 10; i++ {
+		clock.Advance(100 * time.Millisecond)
+		check(1, true)
+		check(1, false)
+	}
+
+	result, err := limiter.Allow(2)
+	if err != nil {
+		t.Fatalf("Error when calling Allow() on active limiter, Error: %v", err)
+	}
+
+	if result.Allowed || result.RetryAfter != 200*time.Millisecond || result.Remaining != 0 {
+		t.Fatalf("Allow() returned unexpected result %+v", result)
+	}
+
+	// the burst is fully available once the theoretical arrival time has passed:
+	clock.Set(result.ResetAt)
+	result, _ = limiter.Allow(0)
+	if result.Remaining != 5 {
+		t.Fatalf("Allow() returned %d remaining tasks, expected 5", result.Remaining)
+	}
+
+	check(6, false)
+	check(5, true)
+
+	limiter.Kill()
+	if _, err := limiter.ShouldAllow(1); err == nil {
+		t.Fatalf("Calling ShouldAllow() on inactive limiter did not throw any errors.")
+	}
+}
+
+func TestGCRAInvalidConfiguration(t *testing.T) {
+	if _, err := NewGCRALimiter(10, time.Nanosecond); err == nil {
+		t.Fatalf("NewGCRALimiter() failed, did not throw error when window size <= 1 millisecond")
+	}
+
+	if _, err := NewGCRALimiter(0, time.Second); err == nil {
+		t.Fatalf("NewGCRALimiter() failed, did not throw error when limit == 0")
+	}
+
+	// the configuration is left unchanged when the emission interval would be less than a nanosecond:
+	limiter, _ := NewGCRALimiter(10, time.Second)
+	if err := limiter.SetLimit(2000000000); !errors.Is(err, ErrInvalidConfig) {
+		t.Fatalf("SetLimit() returned %v, expected %v", err, ErrInvalidConfig)
+	}
+
+	if err := limiter.SetSize(time.Millisecond); err != nil {
+		t.Fatalf("SetSize() returned error %v", err)
+	}
+
+	limiter.SetSize(time.Second)
+	limiter.SetLimit(2000000)
+	if err := limiter.SetSize(time.Millisecond); !errors.Is(err, ErrInvalidConfig) {
+		t.Fatalf("SetSize() returned %v, expected %v", err, ErrInvalidConfig)
+	}
+
+	if _, err := limiter.ShouldAllow(1); err != nil {
+		t.Fatalf("ShouldAllow() returned error %v after an invalid update", err)
+	}
+
+	attributeLimiter := NewAttributeBasedLimiter(false, WithLimiterType(GCRA))
+	attributeLimiter.CreateNewKey("key", 10, time.Second)
+	if err := attributeLimiter.UpdateKey("key", 2000000000, time.Second); !errors.Is(err, ErrInvalidConfig) {
+		t.Fatalf("UpdateKey() returned %v, expected %v", err, ErrInvalidConfig)
+	}
+
+	// neither the limit nor the size is changed when only their combination is invalid:
+	if err := attributeLimiter.UpdateKey("key", 2000000, time.Millisecond); !errors.Is(err, ErrInvalidConfig) {
+		t.Fatalf("UpdateKey() returned %v, expected %v", err, ErrInvalidConfig)
+	}
+
+	if info, _ := attributeLimiter.Get("key"); info.Limit != 10 || info.Size != time.Second {
+		t.Fatalf("UpdateKey() changed the configuration to %+v after an invalid update", info)
+	}
+
+	if _, err := attributeLimiter.ShouldAllow("key", 1); err != nil {
+		t.Fatalf("ShouldAllow() returned error %v after an invalid update", err)
+	}
+}
+
+func TestGCRASetLimit(t *testing.T) {
+	clock := NewManualClock(time.Unix(1000, 0))
+
+	// the burst follows the limit unless it was set using WithBurst:
+	limiter, _ := NewGCRALimiter(10, time.Second, WithClock(clock))
+	limiter.SetLimit(20)
+
+	if result, _ := limiter.Allow(20); !result.Allowed || result.Limit != 20 {
+		t.Fatalf("Allow(20) returned %+v after the limit was raised to 20", result)
+	}
+
+	limiter, _ = NewGCRALimiter(10, time.Second, WithBurst(3), WithClock(clock))
+	limiter.SetLimit(20)
+	if result, _ := limiter.Allow(1); result.Limit != 3 {
+		t.Fatalf("Allow() returned burst %d after the limit was changed, expected 3", result.Limit)
+	}
+
+	// keys following a policy are rescaled along with it:
+	attributeLimiter := NewAttributeBasedLimiter(false, WithClock(clock), WithLimiterType(GCRA))
+	attributeLimiter.SetPolicy(Policy{Name: "free", Limit: 10, Size: time.Second})
+	attributeLimiter.CreateKeyWithPolicy("key", "free")
+	attributeLimiter.SetPolicy(Policy{Name: "free", Limit: 50, Size: time.Second})
+
+	if result, _ := attributeLimiter.Allow("key", 1); result.Limit != 50 {
+		t.Fatalf("Allow() returned limit %d after the policy was changed, expected 50", result.Limit)
+	}
+}
+
+func TestAttributeBasedGCRA(t *testing.T) {
+	clock := NewManualClock(time.Unix(1000, 0))
+	attributeLimiter := NewAttributeBasedLimiter(false, WithClock(clock), WithLimiterType(GCRA))
+
+	if !attributeLimiter.MustShouldAllow("key", 10, 10, time.Second) {
+		t.Fatalf("AttributeBasedLimiter.MustShouldAllow() failed to allow tasks within the burst")
+	}
+
+	limiter, _ := attributeLimiter.getLimiter("key")
+	if _, ok := limiter.(*GCRALimiter); !ok {
+		t.Fatalf("AttributeBasedLimiter did not create a GCRALimiter for the key")
+	}
+
+	result, err := attributeLimiter.Allow("key", 1)
+	if err != nil || result.Allowed || result.RetryAfter != 100*time.Millisecond {
+		t.Fatalf("AttributeBasedLimiter.Allow() returned unexpected result %+v, Error: %v", result, err)
+	}
+}
+
+func BenchmarkGCRALimiter(b *testing.B) {
+	limiter, _ := NewGCRALimiter(100, 1*time.Second)
+
+	for i := 0; i < b.N; i++ {
+		_, err := limiter.ShouldAllow(1)
+		if err != nil {
+			b.Fatalf("Error when calling ShouldAllow() on active limiter, Error: %v", err)
+		}
+	}
+}
@@ -0,0 +1,268 @@
+package ratelimiter
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// HierarchicalLimiter is an AttributeBasedLimiter whose keys can have parents, example: users
+// nested under orgs nested under a global key. Tasks of a key are allowed only if the key and all
+// of it's ancestors allow them, nothing is counted otherwise.
+type HierarchicalLimiter struct {
+	limiter  *AttributeBasedLimiter
+	m        sync.Mutex
+	parents  map[string]string
+	children map[string]map[string]struct{}
+	locks    map[string]*sync.Mutex
+}
+
+// HasKey check if HierarchicalLimiter has a limiter for the key.
+//
+// Parameters:
+//
+// 1. key: a unique key string, example: user id, org id etc
+//
+// Returns a boolean flag, if true, the key is already present, false otherwise.
+func (h *HierarchicalLimiter) HasKey(key string) bool {
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	_, ok := h.parents[key]
+	return ok
+}
+
+// CreateNewKey create a new key-limiter assiociation, nested under the parent key.
+//
+// Parameters:
+//
+// 1. key: a unique key string, example: user id, org id etc
+//
+// 2. parent: key of the parent, empty string for the top level keys.
+//
+// 3. limit: The number of tasks to be allowd
+//
+// 4. size: duration
+//
+// Returns error if the key already exists or the parent does not exist.
+func (h *HierarchicalLimiter) CreateNewKey(key string, parent string, limit uint64, size time.Duration) error {
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	if parent != "" {
+		if _, ok := h.parents[parent]; !ok {
+			return fmt.Errorf("parent %w: %s", ErrKeyNotFound, parent)
+		}
+	}
+
+	if err := h.limiter.CreateNewKey(key, limit, size); err != nil {
+		return err
+	}
+
+	h.parents[key] = parent
+	h.locks[key] = &sync.Mutex{}
+	if parent != "" {
+		if h.children[parent] == nil {
+			h.children[parent] = make(map[string]struct{})
+		}
+		h.children[parent][key] = struct{}{}
+	}
+
+	return nil
+}
+
+// chain returns the key followed by it's ancestors, must be called with lock held.
+func (h *HierarchicalLimiter) chain(key string) ([]string, error) {
+	if _, ok := h.parents[key]; !ok {
+		return nil, fmt.Errorf("%w: %s", ErrKeyNotFound, key)
+	}
+
+	var keys []string
+	for ; key != ""; key = h.parents[key] {
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
+
+// Chain returns the key followed by it's parent, grand parent and so on up to the top level key.
+//
+// Parameters:
+//
+// 1. key: a unique key string, example: user id, org id etc
+//
+// Returns an error if the key is not present.
+func (h *HierarchicalLimiter) Chain(key string) ([]string, error) {
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	return h.chain(key)
+}
+
+// resolve returns the limiters and the locks of the key followed by it's ancestors.
+func (h *HierarchicalLimiter) resolve(key string) ([]Limiter, []*sync.Mutex, error) {
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	keys, err := h.chain(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	limiters := make([]Limiter, len(keys))
+	locks := make([]*sync.Mutex, len(keys))
+	for idx, key := range keys {
+		limiter, err := h.limiter.getLimiter(key)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		limiters[idx] = limiter
+		locks[idx] = h.locks[key]
+	}
+
+	return limiters, locks, nil
+}
+
+// allow checks and counts n tasks on the whole chain of the key. The locks of the chain are taken
+// from the top level key down to the key, so chains sharing ancestors never wait on each other in
+// opposite orders and tasks of unrelated keys are checked in parallel.
+func (h *HierarchicalLimiter) allow(key string, n uint64) (MultiResult, error) {
+	limiters, locks, err := h.resolve(key)
+	if err != nil {
+		return MultiResult{Binding: -1}, err
+	}
+
+	for idx := len(locks) - 1; idx >= 0; idx-- {
+		locks[idx].Lock()
+		defer locks[idx].Unlock()
+	}
+
+	order := make([]int, len(limiters))
+	for idx := range order {
+		order[idx] = idx
+	}
+
+	return allowAll(limiters, order, n)
+}
+
+// ShouldAllow makes decison whether n tasks of the key can be allowed by the key and all of it's ancestors or not.
+//
+// Parameters:
+//
+// 1. key: a unique key string, example: user id, org id etc
+//
+// 2. n: number of tasks to be processed, set this as 1 for a single task.
+// (Example: An HTTP request)
+//
+// Returns (bool, error).
+// (false, error) when any limiter of the chain is inactive (or it is killed) or key is not present.
+// (true/false, nil) if key exists and n tasks can be allowed or not.
+func (h *HierarchicalLimiter) ShouldAllow(key string, n uint64) (bool, error) {
+	result, err := h.allow(key, n)
+	return result.Allowed, err
+}
+
+// Allow makes decison whether n tasks of the key can be allowed or not, just like ShouldAllow, and
+// describes the state of the binding limiter after the decision. MultiResult.Binding is the index
+// of the binding key in the chain returned by Chain, i.e 0 for the key, 1 for it's parent and so on.
+//
+// Parameters:
+//
+// 1. key: a unique key string, example: user id, org id etc
+//
+// 2. n: number of tasks to be processed, set this as 1 for a single task.
+// (Example: An HTTP request)
+//
+// Returns (MultiResult, error).
+// (MultiResult, error) when any limiter of the chain is inactive (or it is killed) or key is not present.
+// (MultiResult, nil) if key exists, MultiResult.Allowed is true/false depending on whether n tasks can be allowed or not.
+func (h *HierarchicalLimiter) Allow(key string, n uint64) (MultiResult, error) {
+	return h.allow(key, n)
+}
+
+// UpdateKey changes the configuration of the limiter associated with the key, without
+// losing the tasks already counted by it. The parent of the key can't be changed.
+//
+// Parameters:
+//
+// 1. key: a unique key string, example: user id, org id etc
+//
+// 2. limit: The number of tasks to be allowd
+//
+// 3. size: duration
+//
+// Returns an error if the key is not present or the configuration is invalid.
+func (h *HierarchicalLimiter) UpdateKey(key string, limit uint64, size time.Duration) error {
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	return h.limiter.UpdateKey(key, limit, size)
+}
+
+// DeleteKey remove the key along with all of it's descendants and kill their underlying limiters.
+//
+// Parameters:
+//
+// 1. key: a unique key string, example: user id, org id etc
+//
+// Returns an error if the key is not present.
+func (h *HierarchicalLimiter) DeleteKey(key string) error {
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	parent, ok := h.parents[key]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrKeyNotFound, key)
+	}
+
+	if err := h.deleteKey(key); err != nil {
+		return err
+	}
+
+	if parent != "" {
+		delete(h.children[parent], key)
+	}
+
+	return nil
+}
+
+// deleteKey removes the key and it's descendants, must be called with lock held. The bookkeeping of
+// a key is removed only once it's limiter is deleted, so the keys that failed are still present.
+func (h *HierarchicalLimiter) deleteKey(key string) error {
+	for child := range h.children[key] {
+		if err := h.deleteKey(child); err != nil {
+			return err
+		}
+
+		delete(h.children[key], child)
+	}
+
+	if err := h.limiter.DeleteKey(key); err != nil {
+		return err
+	}
+
+	delete(h.children, key)
+	delete(h.parents, key)
+	delete(h.locks, key)
+	return nil
+}
+
+// NewHierarchicalLimiter creates an instance of HierarchicalLimiter and returns it's pointer.
+//
+// Parameters:
+//
+// 1. backgroundSliding: if set to true, DefaultLimiter will be used as an underlying limiter,
+// else, SyncLimiter will be used.
+//
+// 2. opts: optional parameters applied to the limiter of every key, example: WithClock, WithLimiterType.
+// WithIdleTTL and WithMaxKeys are ignored, the keys of a HierarchicalLimiter are never evicted.
+func NewHierarchicalLimiter(backgroundSliding bool, opts ...Option) *HierarchicalLimiter {
+	return &HierarchicalLimiter{
+		limiter:  NewAttributeBasedLimiter(backgroundSliding, append(opts[:len(opts):len(opts)], WithIdleTTL(0), WithMaxKeys(0))...),
+		m:        sync.Mutex{},
+		parents:  make(map[string]string),
+		children: make(map[string]map[string]struct{}),
+		locks:    make(map[string]*sync.Mutex),
+	}
+}
@@ -0,0 +1,140 @@
+package ratelimiter
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestHierarchicalLimiter(t *testing.T) {
+	clock := NewManualClock(time.Unix(1000, 0))
+	limiter := NewHierarchicalLimiter(false, WithClock(clock))
+
+	if err := limiter.CreateNewKey("alice", "acme", 10, time.Minute); err == nil {
+		t.Fatalf("CreateNewKey() did not return error for non-existing parent")
+	}
+
+	limiter.CreateNewKey("global", "", 25, time.Minute)
+	limiter.CreateNewKey("acme", "global", 15, time.Minute)
+	limiter.CreateNewKey("alice", "acme", 10, time.Minute)
+	limiter.CreateNewKey("bob", "acme", 10, time.Minute)
+	limiter.CreateNewKey("carol", "global", 10, time.Minute)
+
+	chain, err := limiter.Chain("alice")
+	if err != nil || !reflect.DeepEqual(chain, []string{"alice", "acme", "global"}) {
+		t.Fatalf("Chain(alice) returned (%v, %v)", chain, err)
+	}
+
+	check := func(key string, n uint64, expected bool, binding int) {
+		result, err := limiter.Allow(key, n)
+		if err != nil {
+			t.Fatalf("Allow(%s, %d) returned error %v", key, n, err)
+		}
+		if result.Allowed != expected || result.Binding != binding {
+			t.Fatalf("Allow(%s, %d) returned %+v, expected allowed %v by %d", key, n, result, expected, binding)
+		}
+	}
+
+	check("alice", 8, true, 0)
+	// rejected by the org, alice is not charged:
+	check("bob", 8, false, 1)
+	check("alice", 2, true, 0)
+	check("bob", 5, true, 1)
+
+	// rejected by the global key, the org and user are not charged:
+	check("carol", 10, true, 0)
+	check("carol", 1, false, 0)
+	limiter.UpdateKey("carol", 20, time.Minute)
+	check("carol", 1, false, 1)
+
+	if allowed, _ := limiter.ShouldAllow("alice", 1); allowed {
+		t.Fatalf("ShouldAllow(alice) allowed tasks beyond the limit of the org")
+	}
+
+	// deleting a parent deletes it's children:
+	if err := limiter.DeleteKey("acme"); err != nil {
+		t.Fatalf("DeleteKey(acme) returned error %v", err)
+	}
+
+	for _, key := range []string{"acme", "alice", "bob"} {
+		if limiter.HasKey(key) {
+			t.Fatalf("HasKey(%s) returned true after it's parent was deleted", key)
+		}
+		if _, err := limiter.ShouldAllow(key, 1); err == nil {
+			t.Fatalf("ShouldAllow(%s) did not return error for deleted key", key)
+		}
+	}
+
+	if !limiter.HasKey("carol") || !limiter.HasKey("global") {
+		t.Fatalf("DeleteKey(acme) deleted keys outside of it's subtree")
+	}
+
+	// deleted keys can be created again:
+	if err := limiter.CreateNewKey("acme", "global", 15, time.Minute); err != nil {
+		t.Fatalf("CreateNewKey(acme) returned error %v after it was deleted", err)
+	}
+}
+
+func TestHierarchicalLimiterConcurrent(t *testing.T) {
+	clock := NewManualClock(time.Unix(1000, 0))
+	limiter := NewHierarchicalLimiter(false, WithClock(clock))
+
+	limiter.CreateNewKey("acme", "", 100, time.Minute)
+	users := []string{"alice", "bob", "carol", "dave"}
+	for _, user := range users {
+		limiter.CreateNewKey(user, "acme", 50, time.Minute)
+	}
+
+	var wg sync.WaitGroup
+	var m sync.Mutex
+	allowed := uint64(0)
+
+	for _, user := range users {
+		wg.Add(1)
+		go func(user string) {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				if ok, _ := limiter.ShouldAllow(user, 1); ok {
+					m.Lock()
+					allowed++
+					m.Unlock()
+				}
+			}
+		}(user)
+	}
+
+	wg.Wait()
+
+	// the org allows 100 tasks and the users 200 in total, no task is lost to the rollbacks:
+	if allowed != 100 {
+		t.Fatalf("ShouldAllow() allowed %d tasks, expected 100", allowed)
+	}
+}
+
+func TestHierarchicalLimiterDeleteKeyError(t *testing.T) {
+	limiter := NewHierarchicalLimiter(false)
+
+	limiter.CreateNewKey("acme", "", 10, time.Minute)
+	limiter.CreateNewKey("alice", "acme", 5, time.Minute)
+	limiter.CreateNewKey("bob", "acme", 5, time.Minute)
+
+	// the underlying limiter of bob is gone, so it can't be deleted:
+	limiter.limiter.DeleteKey("bob")
+	if err := limiter.DeleteKey("acme"); err == nil {
+		t.Fatalf("DeleteKey(acme) did not return error when a descendant could not be deleted")
+	}
+
+	// the keys that were not deleted are still present along with their parent:
+	if !limiter.HasKey("acme") || !limiter.HasKey("bob") {
+		t.Fatalf("DeleteKey(acme) removed keys that were not deleted")
+	}
+
+	if chain, _ := limiter.Chain("bob"); !reflect.DeepEqual(chain, []string{"bob", "acme"}) {
+		t.Fatalf("Chain(bob) returned %v after a failed DeleteKey", chain)
+	}
+
+	if _, ok := limiter.children["acme"]["bob"]; !ok {
+		t.Fatalf("DeleteKey(acme) removed bob from the children of acme")
+	}
+}
@@ -0,0 +1,127 @@
+package ratelimiter
+
+import (
+	"time"
+)
+
+// KeyInfo describes the state of the limiter of a key of an AttributeBasedLimiter.
+type KeyInfo struct {
+	// Limit is the number of tasks allowed per window.
+	Limit uint64
+	// Size is the size of the window.
+	Size time.Duration
+	// Current is the number of tasks counted in the current window.
+	Current uint64
+	// Previous is the number of tasks counted in the previous window.
+	Previous uint64
+	// Usage is the estimated number of tasks counted in the sliding window ending now, for the
+	// limiters not based on windows (TokenBucketLimiter, GCRALimiter) it is the number of tasks
+	// the limiter has to recover from before being back to it's full capacity.
+	Usage uint64
+	// Policy is the name of the policy the key was created from, if any.
+	Policy string
+}
+
+// inspector is implemented by limiters that can describe their state without changing it.
+type inspector interface {
+	inspect() KeyInfo
+}
+
+// keySnapshot is the entry of a key copied out of it's shard.
+type keySnapshot struct {
+	key     string
+	limiter Limiter
+	size    time.Duration
+	policy  string
+}
+
+func (k keySnapshot) info() KeyInfo {
+	info := KeyInfo{Size: k.size}
+	if i, ok := k.limiter.(inspector); ok {
+		info = i.inspect()
+	}
+
+	info.Policy = k.policy
+	return info
+}
+
+// snapshot copies the entries of the shard, so that they can be inspected without the shard locked.
+func (s *attributeShard) snapshot() []keySnapshot {
+	s.m.RLock()
+	defer s.m.RUnlock()
+
+	snapshots := make([]keySnapshot, 0, len(s.entries))
+	for key, entry := range s.entries {
+		snapshots = append(snapshots, keySnapshot{key: key, limiter: entry.limiter, size: entry.size, policy: entry.policy})
+	}
+
+	return snapshots
+}
+
+// Keys returns the keys having a rate limiter, in no particular order.
+func (a *AttributeBasedLimiter) Keys() []string {
+	var keys []string
+	for _, shard := range a.shards {
+		shard.m.RLock()
+		for key := range shard.entries {
+			keys = append(keys, key)
+		}
+		shard.m.RUnlock()
+	}
+
+	return keys
+}
+
+// Len returns the number of keys having a rate limiter.
+func (a *AttributeBasedLimiter) Len() int {
+	n := 0
+	for _, shard := range a.shards {
+		shard.m.RLock()
+		n += len(shard.entries)
+		shard.m.RUnlock()
+	}
+
+	return n
+}
+
+// Range calls fn with the state of every key, in no particular order, until fn returns false. The keys
+// of a shard are copied before being inspected one at a time, so that ShouldAllow is never blocked for
+// long, the state of each key is consistent but the keys are not inspected at the same instant.
+//
+// Parameters:
+//
+// 1. fn: function called with the key and the state of it's limiter.
+func (a *AttributeBasedLimiter) Range(fn func(key string, info KeyInfo) bool) {
+	for _, shard := range a.shards {
+		for _, snapshot := range shard.snapshot() {
+			if !fn(snapshot.key, snapshot.info()) {
+				return
+			}
+		}
+	}
+}
+
+// Get returns the state of the limiter of the key, without marking the key as used.
+//
+// Parameters:
+//
+// 1. key: a unique key string, example: IP address, token, uuid etc
+//
+// Returns (KeyInfo, bool), the bool is false if the key is not present.
+func (a *AttributeBasedLimiter) Get(key string) (KeyInfo, bool) {
+	shard := a.shard(key)
+
+	shard.m.RLock()
+	entry, ok := shard.entries[key]
+	var snapshot keySnapshot
+	if ok {
+		snapshot = keySnapshot{key: key, limiter: entry.limiter, size: entry.size, policy: entry.policy}
+	}
+	shard.m.RUnlock()
+
+	if !ok {
+		return KeyInfo{}, false
+	}
+
+	return snapshot.info(), true
+}
@@ -0,0 +1,119 @@
+package ratelimiter
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestAttributeBasedLimiterInspect(t *testing.T) {
+	clock := NewManualClock(time.Unix(1000, 0))
+	attributeLimiter := NewAttributeBasedLimiter(false, WithClock(clock))
+
+	if attributeLimiter.Len() != 0 || len(attributeLimiter.Keys()) != 0 {
+		t.Fatalf("empty AttributeBasedLimiter returned keys")
+	}
+
+	attributeLimiter.CreateNewKey("sliding", 10, time.Second)
+	attributeLimiter.SetPolicy(Policy{Name: "free", Limit: 5, Size: time.Minute})
+	attributeLimiter.CreateKeyWithPolicy("free-user", "free")
+	attributeLimiter.AddLimiter("custom", &countingLimiter{limit: 2})
+
+	bucket, _ := NewTokenBucketLimiter(10, time.Second, WithClock(clock))
+	attributeLimiter.AddLimiter("bucket", bucket)
+
+	keys := attributeLimiter.Keys()
+	sort.Strings(keys)
+	if !reflect.DeepEqual(keys, []string{"bucket", "custom", "free-user", "sliding"}) || attributeLimiter.Len() != 4 {
+		t.Fatalf("Keys() returned %v, Len() returned %d", keys, attributeLimiter.Len())
+	}
+
+	attributeLimiter.ShouldAllow("sliding", 6)
+	clock.Advance(1500 * time.Millisecond)
+	attributeLimiter.ShouldAllow("sliding", 2)
+	attributeLimiter.ShouldAllow("free-user", 3)
+	attributeLimiter.ShouldAllow("bucket", 4)
+
+	expected := map[string]KeyInfo{
+		// half of the previous window overlaps the sliding window:
+		"sliding":   {Limit: 10, Size: time.Second, Current: 2, Previous: 6, Usage: 5},
+		"free-user": {Limit: 5, Size: time.Minute, Current: 3, Usage: 3, Policy: "free"},
+		"bucket":    {Limit: 10, Size: time.Second, Usage: 4},
+		// limiters that can't be inspected are described by the key only:
+		"custom": {},
+	}
+
+	for key, info := range expected {
+		if got, ok := attributeLimiter.Get(key); !ok || got != info {
+			t.Fatalf("Get(%s) returned (%+v, %v), expected %+v", key, got, ok, info)
+		}
+	}
+
+	if _, ok := attributeLimiter.Get("unknown"); ok {
+		t.Fatalf("Get() returned true for non-existing key")
+	}
+
+	ranged := make(map[string]KeyInfo)
+	attributeLimiter.Range(func(key string, info KeyInfo) bool {
+		ranged[key] = info
+		return true
+	})
+
+	if !reflect.DeepEqual(ranged, expected) {
+		t.Fatalf("Range() returned %+v, expected %+v", ranged, expected)
+	}
+
+	calls := 0
+	attributeLimiter.Range(func(key string, info KeyInfo) bool {
+		calls++
+		return false
+	})
+
+	if calls != 1 {
+		t.Fatalf("Range() called fn %d times after it returned false", calls)
+	}
+}
+
+func TestLimiterInspect(t *testing.T) {
+	clock := NewManualClock(time.Unix(1000, 0))
+
+	gcra, _ := NewGCRALimiter(10, time.Second, WithClock(clock))
+	fixed, _ := NewFixedWindowLimiter(10, time.Second, WithClock(clock))
+	log, _ := NewSlidingLogLimiter(10, time.Second, WithClock(clock))
+	atomicLimiter, _ := NewAtomicLimiter(10, time.Second, WithClock(clock))
+	defaultLimiter, _ := NewDefaultLimiter(10, time.Second, WithClock(clock))
+	defer defaultLimiter.Kill()
+
+	limiters := map[string]Limiter{
+		"gcra": gcra, "fixed": fixed, "log": log, "atomic": atomicLimiter, "default": defaultLimiter,
+	}
+
+	for _, limiter := range limiters {
+		limiter.ShouldAllow(4)
+	}
+
+	expected := map[string]KeyInfo{
+		"gcra":    {Limit: 10, Size: time.Second, Usage: 4},
+		"fixed":   {Limit: 10, Size: time.Second, Current: 4, Usage: 4},
+		"log":     {Limit: 10, Size: time.Second, Current: 4, Usage: 4},
+		"atomic":  {Limit: 10, Size: time.Second, Current: 4, Usage: 4},
+		"default": {Limit: 10, Size: time.Second, Current: 4, Usage: 4},
+	}
+
+	for name, limiter := range limiters {
+		if info := limiter.(inspector).inspect(); info != expected[name] {
+			t.Fatalf("inspect() on %s limiter returned %+v, expected %+v", name, info, expected[name])
+		}
+	}
+}
+
+func TestGCRAInspectZeroInterval(t *testing.T) {
+	clock := NewManualClock(time.Unix(1000, 0))
+
+	// a limiter whose emission interval is less than a nanosecond can't count tasks, inspecting it must not panic:
+	limiter := &GCRALimiter{tat: clock.Now().Add(time.Second).UnixNano(), limit: 2000000000, size: time.Second, burst: 1, clock: clock}
+	if info := limiter.inspect(); info.Usage != 0 || info.Limit != 2000000000 {
+		t.Fatalf("inspect() returned %+v", info)
+	}
+}
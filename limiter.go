@@ -15,14 +15,20 @@ type Limiter interface {
 
 // DefaultLimiter maintains all the structures used for rate limting using a background goroutine.
 type DefaultLimiter struct {
-	previous      *Window
-	current       *Window
-	lock          sync.Mutex
-	size          time.Duration
-	limit         uint64
-	killed        bool
-	windowContext context.Context
-	cancelFn      func()
+	previous     *Window
+	current      *Window
+	lock         sync.Mutex
+	size         time.Duration
+	limit        uint64
+	killed       bool
+	clock        Clock
+	scheduler    *scheduler
+	slideEntry   slideEntry
+	waiters      waitQueue
+	reserved     []uint64
+	reservations reservationQueue
+	seq          uint64
+	notifier     notifier
 }
 
 // ShouldAllow makes decison whether n tasks can be allowed or not.
@@ -38,44 +44,321 @@ func (l *DefaultLimiter) ShouldAllow(n uint64) (bool, error) {
 	defer l.lock.Unlock()
 
 	if l.killed {
-		return false, fmt.Errorf("function ShouldAllow called on an inactive instance")
+		return false, fmt.Errorf("function ShouldAllow called on an inactive instance: %w", ErrLimiterKilled)
 	}
 
 	if l.limit == 0 || l.size < time.Millisecond {
-		return false, fmt.Errorf("invalid limiter configuration")
+		return false, ErrInvalidConfig
 	}
 
-	currentTime := time.Now()
-	currentWindowBoundary := currentTime.Sub(l.current.getStartTime())
+	allowed := admits(l.previous, l.current, l.reserved, l.clock.Now(), l.size, l.limit, n)
+	if allowed {
+		// add current request count to window of current count
+		l.current.updateCount(n)
+	}
+
+	l.notifier.notify(n, allowed)
+	return allowed, nil
+}
+
+// Peek reports whether n tasks would be allowed right now, without counting them.
+//
+// Parameters:
+//
+// 1. n: number of tasks to be processed, set this as 1 for a single task. (Example: An HTTP request)
+//
+// Returns (bool, error). (false, error) if limiter is inactive (or it is killed). Otherwise,
+// (true/false, nil) depending on whether n tasks would be allowed or not.
+func (l *DefaultLimiter) Peek(n uint64) (bool, error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
 
-	w := float64(l.size-currentWindowBoundary) / float64(l.size)
+	if l.killed {
+		return false, fmt.Errorf("function Peek called on an inactive instance: %w", ErrLimiterKilled)
+	}
 
-	currentSlidingRequests := uint64(w*float64(l.previous.count)) + l.current.count
+	if l.limit == 0 || l.size < time.Millisecond {
+		return false, ErrInvalidConfig
+	}
 
-	if currentSlidingRequests+n > l.limit {
-		return false, nil
+	return admits(l.previous, l.current, l.reserved, l.clock.Now(), l.size, l.limit, n), nil
+}
+
+// inspect describes the state of the limiter.
+func (l *DefaultLimiter) inspect() KeyInfo {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	return KeyInfo{
+		Limit:    l.limit,
+		Size:     l.size,
+		Current:  l.current.count,
+		Previous: l.previous.count,
+		Usage:    slidingCount(l.previous, l.current, l.clock.Now(), l.size),
+	}
+}
+
+// Consume counts n tasks that already happened even if they exceed the limit, example: bytes
+// already received on a stream. The count may go over the limit, in which case ShouldAllow rejects
+// the tasks until the overdraft decays out of the previous window.
+//
+// Parameters:
+//
+// 1. n: number of tasks to be counted.
+//
+// Returns (uint64, error). (0, error) if limiter is inactive (or it is killed). Otherwise,
+// (debt, nil) where debt is the number of tasks counted beyond the limit, zero if there is none.
+func (l *DefaultLimiter) Consume(n uint64) (uint64, error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if l.killed {
+		return 0, fmt.Errorf("function Consume called on an inactive instance: %w", ErrLimiterKilled)
+	}
+
+	if l.limit == 0 || l.size < time.Millisecond {
+		return 0, ErrInvalidConfig
 	}
 
-	// add current request count to window of current count
 	l.current.updateCount(n)
-	return true, nil
+	return debt(l.previous, l.current, l.clock.Now(), l.size, l.limit), nil
+}
+
+// Allow makes decison whether n tasks can be allowed or not, just like ShouldAllow,
+// and describes the state of the limiter after the decision.
+//
+// Parameters:
+//
+// 1. n: number of tasks to be processed, set this as 1 for a single task. (Example: An HTTP request)
+//
+// Returns (Result, error). (Result{}, error) if limiter is inactive (or it is killed). Otherwise,
+// (Result, nil) where Result.Allowed is true/false depending on whether n tasks can be allowed or not.
+func (l *DefaultLimiter) Allow(n uint64) (Result, error) {
+	return l.allowResult(n, true)
+}
+
+// allowResult is Allow, the observer is notified of the decision only if notify is true.
+func (l *DefaultLimiter) allowResult(n uint64, notify bool) (Result, error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if l.killed {
+		return Result{}, fmt.Errorf("function Allow called on an inactive instance: %w", ErrLimiterKilled)
+	}
+
+	if l.limit == 0 || l.size < time.Millisecond {
+		return Result{}, ErrInvalidConfig
+	}
+
+	currentTime := l.clock.Now()
+	allowed := admits(l.previous, l.current, l.reserved, currentTime, l.size, l.limit, n)
+	if allowed {
+		l.current.updateCount(n)
+	}
+
+	if notify {
+		l.notifier.notify(n, allowed)
+	}
+	return windowResult(l.previous, l.current, l.reserved, currentTime, l.size, l.limit, n, allowed), nil
+}
+
+// observer returns the notifier of the observer of the limiter.
+func (l *DefaultLimiter) observer() notifier {
+	return l.notifier
+}
+
+// Wait blocks until n tasks can be allowed and counts them, or until ctx is done.
+// Waiting goroutines are served in FIFO order, so a large n is not starved by smaller ones.
+//
+// Parameters:
+//
+// 1. ctx: context used to cancel the wait.
+//
+// 2. n: number of tasks to be processed, must not be greater than the limit.
+//
+// Returns nil once n tasks are allowed, ctx.Err() if ctx is done before that, or an error
+// if the limiter is inactive (or it is killed) or n can never be allowed.
+func (l *DefaultLimiter) Wait(ctx context.Context, n uint64) error {
+	return l.waiters.wait(ctx, l.clock, func() (bool, time.Duration, error) {
+		return l.tryAllow(n)
+	})
+}
+
+func (l *DefaultLimiter) tryAllow(n uint64) (bool, time.Duration, error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if l.killed {
+		return false, 0, fmt.Errorf("function Wait called on an inactive instance: %w", ErrLimiterKilled)
+	}
+
+	if l.limit == 0 || l.size < time.Millisecond {
+		return false, 0, ErrInvalidConfig
+	}
+
+	if n > l.limit {
+		return false, 0, fmt.Errorf("%w: n = %d, limit = %d", ErrExceedsLimit, n, l.limit)
+	}
+
+	currentTime := l.clock.Now()
+	if !admits(l.previous, l.current, l.reserved, currentTime, l.size, l.limit, n) {
+		_, allowedAt := nextSlot(l.previous, l.current, l.reserved, currentTime, l.size, l.limit, n)
+		return false, allowedAt.Sub(currentTime), nil
+	}
+
+	l.current.updateCount(n)
+	return true, 0, nil
+}
+
+// Reserve books the capacity for n tasks at the earliest point of time they can be allowed.
+// Reservations are served in the order they are made, the caller must wait for the
+// Delay of the returned Reservation before processing the tasks, or Cancel it.
+//
+// Parameters:
+//
+// 1. n: number of tasks to be processed, must not be greater than the limit.
+//
+// Returns a Reservation, it's OK method returns false if the limiter is inactive
+// (or it is killed) or n can never be allowed.
+func (l *DefaultLimiter) Reserve(n uint64) *Reservation {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if l.killed || l.limit == 0 || l.size < time.Millisecond || n > l.limit {
+		return &Reservation{ok: false}
+	}
+
+	from := l.reservations.from(l.clock.Now())
+
+	j, timeToAct := nextSlot(l.previous, l.current, l.reserved, from, l.size, l.limit, n)
+	if j > int64(len(l.reserved))+1 {
+		j = int64(len(l.reserved)) + 1
+	}
+
+	l.reserved = book(l.current, l.reserved, j, n)
+	l.reservations.push(timeToAct)
+
+	return &Reservation{
+		ok:        true,
+		n:         n,
+		seq:       l.seq + uint64(j),
+		timeToAct: timeToAct,
+		limiter:   l,
+		clock:     l.clock,
+	}
 }
 
-func (l *DefaultLimiter) progressiveWindowSlider() {
-	for {
-		select {
-		case <-l.windowContext.Done():
-			return
-		default:
-			toSleepDuration := l.size - time.Since(l.current.getStartTime())
-			time.Sleep(toSleepDuration)
-			l.lock.Lock()
-			// make current as previous and create a new current window
-			l.previous.setStateFrom(l.current)
-			l.current.resetToTime(time.Now())
-			l.lock.Unlock()
-		}
+func (l *DefaultLimiter) cancelReservation(r *Reservation) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if r.seq < l.seq || !l.clock.Now().Before(r.timeToAct) {
+		return
 	}
+
+	l.reservations.remove(r.timeToAct)
+	l.reserved = unbook(l.current, l.reserved, int64(r.seq-l.seq), r.n)
+}
+
+// slide makes current as previous and creates a new current window, it is called by
+// the scheduler once the current window is over.
+func (l *DefaultLimiter) slide() {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if l.killed {
+		return
+	}
+
+	l.previous.setStateFrom(l.current)
+	l.current.resetToTime(l.clock.Now())
+	if len(l.reserved) > 0 {
+		l.current.updateCount(l.reserved[0])
+		l.reserved = l.reserved[1:]
+	}
+	l.seq++
+
+	l.scheduleSlide()
+}
+
+// scheduleSlide schedules the next slide at the end of the current window, must be called with lock held.
+func (l *DefaultLimiter) scheduleSlide() {
+	l.scheduler.schedule(&l.slideEntry, l.current.getStartTime().Add(l.size))
+}
+
+// SetLimit changes the number of tasks to be allowed per window, the tasks already counted
+// in the windows are retained.
+//
+// Parameters:
+//
+// 1. limit: The number of tasks to be allowd
+//
+// Returns an error if the limiter is inactive (or it is killed) or limit is 0.
+func (l *DefaultLimiter) SetLimit(limit uint64) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if l.killed {
+		return fmt.Errorf("function SetLimit called on an inactive instance: %w", ErrLimiterKilled)
+	}
+
+	if limit == 0 {
+		return ErrInvalidConfig
+	}
+
+	l.limit = limit
+	return nil
+}
+
+// SetSize changes the window size, the counts of the windows are rescaled to the new size
+// and the background window slider is woken up, so the new size takes effect immediately.
+//
+// Parameters:
+//
+// 1. size: duration
+//
+// Returns an error if the limiter is inactive (or it is killed) or size is less than a millisecond.
+func (l *DefaultLimiter) SetSize(size time.Duration) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if l.killed {
+		return fmt.Errorf("function SetSize called on an inactive instance: %w", ErrLimiterKilled)
+	}
+
+	if size < time.Millisecond {
+		return ErrInvalidConfig
+	}
+
+	if l.size >= time.Millisecond {
+		rescale(l.previous, l.current, l.reserved, l.size, size)
+	}
+	l.size = size
+
+	// the current window ends at a different time now.
+	l.scheduleSlide()
+	return nil
+}
+
+// Return gives back n tasks that were allowed but not performed. They are taken off the window
+// they were counted in, if the window has slid since then they are taken off the previous window,
+// tasks counted before that are already out of the sliding window. The counts never go below zero.
+//
+// Parameters:
+//
+// 1. n: number of tasks to be given back.
+//
+// 2. chargedAt: time at which the tasks were allowed, read from the clock of the limiter
+// (time.Now() unless WithClock is used) right after ShouldAllow returned.
+func (l *DefaultLimiter) Return(n uint64, chargedAt time.Time) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	uncount(l.previous, l.current, n, chargedAt)
+}
+
+func (l *DefaultLimiter) refund(n uint64) {
+	l.Return(n, l.clock.Now())
 }
 
 // Kill the limiter, returns error if the limiter has been killed already.
@@ -84,10 +367,10 @@ func (l *DefaultLimiter) Kill() error {
 	defer l.lock.Unlock()
 
 	if l.killed {
-		return fmt.Errorf("called Kill on already killed limiter")
+		return fmt.Errorf("called Kill on already killed limiter: %w", ErrLimiterKilled)
 	}
 
-	defer l.cancelFn()
+	l.scheduler.remove(&l.slideEntry)
 	l.killed = true
 	return nil
 }
@@ -99,25 +382,39 @@ func (l *DefaultLimiter) Kill() error {
 // 1. limit: The number of tasks to be allowd
 //
 // 2. size: duration
-func NewDefaultLimiter(limit uint64, size time.Duration) *DefaultLimiter {
-	previous := NewWindow(0, time.Unix(0, 0))
-	current := NewWindow(0, time.Unix(0, 0))
+//
+// 3. opts: optional parameters, example: WithClock, WithName, WithObserver
+//
+// Returns an error if limit is 0 or size is less than a millisecond.
+func NewDefaultLimiter(limit uint64, size time.Duration, opts ...Option) (*DefaultLimiter, error) {
+	if limit == 0 || size < time.Millisecond {
+		return nil, ErrInvalidConfig
+	}
 
-	childCtx, cancelFn := context.WithCancel(context.Background())
+	o := newOptions(opts)
+
+	previous := NewWindow(0, time.Unix(0, 0))
+	current := NewWindow(0, o.clock.Now())
 
 	limiter := &DefaultLimiter{
-		previous:      previous,
-		current:       current,
-		lock:          sync.Mutex{},
-		size:          size,
-		limit:         limit,
-		killed:        false,
-		windowContext: childCtx,
-		cancelFn:      cancelFn,
+		previous:  previous,
+		current:   current,
+		lock:      sync.Mutex{},
+		size:      size,
+		limit:     limit,
+		killed:    false,
+		clock:     o.clock,
+		scheduler: schedulerFor(o.clock),
+		notifier:  o.notifier(),
 	}
 
-	go limiter.progressiveWindowSlider()
-	return limiter
+	limiter.slideEntry = slideEntry{limiter: limiter, index: -1}
+
+	limiter.lock.Lock()
+	limiter.scheduleSlide()
+	limiter.lock.Unlock()
+
+	return limiter, nil
 }
 
 // SyncLimiter maintains all the structures used for rate limting on demand.
@@ -128,6 +425,13 @@ type SyncLimiter struct {
 	size     time.Duration
 	limit    uint64
 	killed   bool
+	clock    Clock
+	waiters  waitQueue
+
+	reserved     []uint64
+	reservations reservationQueue
+	seq          uint64
+	notifier     notifier
 }
 
 func (s *SyncLimiter) getNSlidesSince(now time.Time) (time.Duration, time.Time) {
@@ -150,51 +454,366 @@ func (s *SyncLimiter) ShouldAllow(n uint64) (bool, error) {
 	defer s.lock.Unlock()
 
 	if s.killed {
-		return false, fmt.Errorf("function ShouldAllow called on an inactive instance")
+		return false, fmt.Errorf("function ShouldAllow called on an inactive instance: %w", ErrLimiterKilled)
 	}
 
 	if s.limit == 0 || s.size < time.Millisecond {
-		return false, fmt.Errorf("invalid limiter configuration")
+		return false, ErrInvalidConfig
 	}
 
-	currentTime := time.Now()
+	currentTime := s.clock.Now()
+	s.advance(currentTime)
 
-	// advance the window on demand, as this doesn't make use of goroutine.
-	nSlides, alignedCurrentTime := s.getNSlidesSince(currentTime)
+	allowed := admits(s.previous, s.current, s.reserved, currentTime, s.size, s.limit, n)
+	if allowed {
+		// add current request count to window of current count
+		s.current.updateCount(n)
+	}
 
-	// window slide shares both current and previous windows.
-	if nSlides == 1 {
-		s.previous.setToState(
-			alignedCurrentTime.Add(-s.size),
-			s.current.count,
-		)
+	s.notifier.notify(n, allowed)
+	return allowed, nil
+}
 
-		s.current.resetToTime(
-			alignedCurrentTime,
-		)
+// Peek reports whether n tasks would be allowed right now, without counting them.
+//
+// Parameters:
+//
+// 1. n: number of tasks to be processed, set this as 1 for a single task. (Example: An HTTP request)
+//
+// Returns (bool, error). (false, error) if limiter is inactive (or it is killed). Otherwise,
+// (true/false, nil) depending on whether n tasks would be allowed or not.
+func (s *SyncLimiter) Peek(n uint64) (bool, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.killed {
+		return false, fmt.Errorf("function Peek called on an inactive instance: %w", ErrLimiterKilled)
+	}
 
-	} else if nSlides > 1 {
-		s.previous.resetToTime(
-			alignedCurrentTime.Add(-s.size),
-		)
-		s.current.resetToTime(
-			alignedCurrentTime,
-		)
+	if s.limit == 0 || s.size < time.Millisecond {
+		return false, ErrInvalidConfig
 	}
 
-	currentWindowBoundary := currentTime.Sub(s.current.getStartTime())
+	currentTime := s.clock.Now()
+	previous, current, reserved, _ := s.windowsAt(currentTime)
+
+	return admits(previous, current, reserved, currentTime, s.size, s.limit, n), nil
+}
 
-	w := float64(s.size-currentWindowBoundary) / float64(s.size)
+// inspect describes the state of the limiter.
+func (s *SyncLimiter) inspect() KeyInfo {
+	s.lock.Lock()
+	defer s.lock.Unlock()
 
-	currentSlidingRequests := uint64(w*float64(s.previous.count)) + s.current.count
+	currentTime := s.clock.Now()
+	previous, current, _, _ := s.windowsAt(currentTime)
 
-	if currentSlidingRequests+n > s.limit {
-		return false, nil
+	return KeyInfo{
+		Limit:    s.limit,
+		Size:     s.size,
+		Current:  current.count,
+		Previous: previous.count,
+		Usage:    slidingCount(previous, current, currentTime, s.size),
 	}
+}
+
+// Consume counts n tasks that already happened even if they exceed the limit, example: bytes
+// already received on a stream. The count may go over the limit, in which case ShouldAllow rejects
+// the tasks until the overdraft decays out of the previous window.
+//
+// Parameters:
+//
+// 1. n: number of tasks to be counted.
+//
+// Returns (uint64, error). (0, error) if limiter is inactive (or it is killed). Otherwise,
+// (debt, nil) where debt is the number of tasks counted beyond the limit, zero if there is none.
+func (s *SyncLimiter) Consume(n uint64) (uint64, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.killed {
+		return 0, fmt.Errorf("function Consume called on an inactive instance: %w", ErrLimiterKilled)
+	}
+
+	if s.limit == 0 || s.size < time.Millisecond {
+		return 0, ErrInvalidConfig
+	}
+
+	currentTime := s.clock.Now()
+	s.advance(currentTime)
 
-	// add current request count to window of current count
 	s.current.updateCount(n)
-	return true, nil
+	return debt(s.previous, s.current, currentTime, s.size, s.limit), nil
+}
+
+// Allow makes decison whether n tasks can be allowed or not, just like ShouldAllow,
+// and describes the state of the limiter after the decision.
+//
+// Parameters:
+//
+// 1. n: number of tasks to be processed, set this as 1 for a single task. (Example: An HTTP request)
+//
+// Returns (Result, error). (Result{}, error) if limiter is inactive (or it is killed). Otherwise,
+// (Result, nil) where Result.Allowed is true/false depending on whether n tasks can be allowed or not.
+func (s *SyncLimiter) Allow(n uint64) (Result, error) {
+	return s.allowResult(n, true)
+}
+
+// allowResult is Allow, the observer is notified of the decision only if notify is true.
+func (s *SyncLimiter) allowResult(n uint64, notify bool) (Result, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.killed {
+		return Result{}, fmt.Errorf("function Allow called on an inactive instance: %w", ErrLimiterKilled)
+	}
+
+	if s.limit == 0 || s.size < time.Millisecond {
+		return Result{}, ErrInvalidConfig
+	}
+
+	currentTime := s.clock.Now()
+	s.advance(currentTime)
+
+	allowed := admits(s.previous, s.current, s.reserved, currentTime, s.size, s.limit, n)
+	if allowed {
+		s.current.updateCount(n)
+	}
+
+	if notify {
+		s.notifier.notify(n, allowed)
+	}
+	return windowResult(s.previous, s.current, s.reserved, currentTime, s.size, s.limit, n, allowed), nil
+}
+
+// observer returns the notifier of the observer of the limiter.
+func (s *SyncLimiter) observer() notifier {
+	return s.notifier
+}
+
+// Wait blocks until n tasks can be allowed and counts them, or until ctx is done.
+// Waiting goroutines are served in FIFO order, so a large n is not starved by smaller ones.
+//
+// Parameters:
+//
+// 1. ctx: context used to cancel the wait.
+//
+// 2. n: number of tasks to be processed, must not be greater than the limit.
+//
+// Returns nil once n tasks are allowed, ctx.Err() if ctx is done before that, or an error
+// if the limiter is inactive (or it is killed) or n can never be allowed.
+func (s *SyncLimiter) Wait(ctx context.Context, n uint64) error {
+	return s.waiters.wait(ctx, s.clock, func() (bool, time.Duration, error) {
+		return s.tryAllow(n)
+	})
+}
+
+func (s *SyncLimiter) tryAllow(n uint64) (bool, time.Duration, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.killed {
+		return false, 0, fmt.Errorf("function Wait called on an inactive instance: %w", ErrLimiterKilled)
+	}
+
+	if s.limit == 0 || s.size < time.Millisecond {
+		return false, 0, ErrInvalidConfig
+	}
+
+	if n > s.limit {
+		return false, 0, fmt.Errorf("%w: n = %d, limit = %d", ErrExceedsLimit, n, s.limit)
+	}
+
+	currentTime := s.clock.Now()
+	s.advance(currentTime)
+
+	if !admits(s.previous, s.current, s.reserved, currentTime, s.size, s.limit, n) {
+		_, allowedAt := nextSlot(s.previous, s.current, s.reserved, currentTime, s.size, s.limit, n)
+		return false, allowedAt.Sub(currentTime), nil
+	}
+
+	s.current.updateCount(n)
+	return true, 0, nil
+}
+
+// Reserve books the capacity for n tasks at the earliest point of time they can be allowed.
+// Reservations are served in the order they are made, the caller must wait for the
+// Delay of the returned Reservation before processing the tasks, or Cancel it.
+//
+// Parameters:
+//
+// 1. n: number of tasks to be processed, must not be greater than the limit.
+//
+// Returns a Reservation, it's OK method returns false if the limiter is inactive
+// (or it is killed) or n can never be allowed.
+func (s *SyncLimiter) Reserve(n uint64) *Reservation {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.killed || s.limit == 0 || s.size < time.Millisecond || n > s.limit {
+		return &Reservation{ok: false}
+	}
+
+	currentTime := s.clock.Now()
+	s.advance(currentTime)
+
+	from := s.reservations.from(currentTime)
+
+	j, timeToAct := nextSlot(s.previous, s.current, s.reserved, from, s.size, s.limit, n)
+	if j > int64(len(s.reserved))+1 {
+		j = int64(len(s.reserved)) + 1
+	}
+
+	s.reserved = book(s.current, s.reserved, j, n)
+	s.reservations.push(timeToAct)
+
+	return &Reservation{
+		ok:        true,
+		n:         n,
+		seq:       s.seq + uint64(j),
+		timeToAct: timeToAct,
+		limiter:   s,
+		clock:     s.clock,
+	}
+}
+
+func (s *SyncLimiter) cancelReservation(r *Reservation) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	currentTime := s.clock.Now()
+	s.advance(currentTime)
+
+	if r.seq < s.seq || !currentTime.Before(r.timeToAct) {
+		return
+	}
+
+	s.reservations.remove(r.timeToAct)
+	s.reserved = unbook(s.current, s.reserved, int64(r.seq-s.seq), r.n)
+}
+
+// advance the window on demand, as this doesn't make use of goroutine.
+// windowsAt returns the windows as they would be after sliding them to currentTime along
+// with the number of slides, the windows of the limiter are returned as is if no slide is due.
+func (s *SyncLimiter) windowsAt(currentTime time.Time) (*Window, *Window, []uint64, int64) {
+	nSlides, alignedCurrentTime := s.getNSlidesSince(currentTime)
+
+	if nSlides < 1 {
+		return s.previous, s.current, s.reserved, 0
+	}
+
+	// window slide shares both current and previous windows,
+	// windows booked by reservations become current as time passes.
+	previous := NewWindow(
+		reservedCount(s.current, s.reserved, int64(nSlides)-1),
+		alignedCurrentTime.Add(-s.size),
+	)
+
+	current := NewWindow(
+		reservedCount(s.current, s.reserved, int64(nSlides)),
+		alignedCurrentTime,
+	)
+
+	var reserved []uint64
+	if int64(nSlides) < int64(len(s.reserved)) {
+		reserved = s.reserved[nSlides:]
+	}
+
+	return previous, current, reserved, int64(nSlides)
+}
+
+func (s *SyncLimiter) advance(currentTime time.Time) {
+	previous, current, reserved, nSlides := s.windowsAt(currentTime)
+
+	if nSlides < 1 {
+		return
+	}
+
+	s.previous.setStateFrom(previous)
+	s.current.setStateFrom(current)
+	s.reserved = reserved
+	s.seq += uint64(nSlides)
+}
+
+// SetLimit changes the number of tasks to be allowed per window, the tasks already counted
+// in the windows are retained.
+//
+// Parameters:
+//
+// 1. limit: The number of tasks to be allowd
+//
+// Returns an error if the limiter is inactive (or it is killed) or limit is 0.
+func (s *SyncLimiter) SetLimit(limit uint64) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.killed {
+		return fmt.Errorf("function SetLimit called on an inactive instance: %w", ErrLimiterKilled)
+	}
+
+	if limit == 0 {
+		return ErrInvalidConfig
+	}
+
+	s.limit = limit
+	return nil
+}
+
+// SetSize changes the window size, the counts of the windows are rescaled to the new size
+// and the windows are re-aligned to it.
+//
+// Parameters:
+//
+// 1. size: duration
+//
+// Returns an error if the limiter is inactive (or it is killed) or size is less than a millisecond.
+func (s *SyncLimiter) SetSize(size time.Duration) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.killed {
+		return fmt.Errorf("function SetSize called on an inactive instance: %w", ErrLimiterKilled)
+	}
+
+	if size < time.Millisecond {
+		return ErrInvalidConfig
+	}
+
+	if s.size >= time.Millisecond {
+		currentTime := s.clock.Now()
+		s.advance(currentTime)
+
+		rescale(s.previous, s.current, s.reserved, s.size, size)
+
+		alignedCurrentTime := currentTime.Truncate(size)
+		s.previous.setToState(alignedCurrentTime.Add(-size), s.previous.count)
+		s.current.setToState(alignedCurrentTime, s.current.count)
+	}
+	s.size = size
+
+	return nil
+}
+
+// Return gives back n tasks that were allowed but not performed. They are taken off the window
+// they were counted in, if the window has slid since then they are taken off the previous window,
+// tasks counted before that are already out of the sliding window. The counts never go below zero.
+//
+// Parameters:
+//
+// 1. n: number of tasks to be given back.
+//
+// 2. chargedAt: time at which the tasks were allowed, read from the clock of the limiter
+// (time.Now() unless WithClock is used) right after ShouldAllow returned.
+func (s *SyncLimiter) Return(n uint64, chargedAt time.Time) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.advance(s.clock.Now())
+	uncount(s.previous, s.current, n, chargedAt)
+}
+
+func (s *SyncLimiter) refund(n uint64) {
+	s.Return(n, s.clock.Now())
 }
 
 // Kill the limiter, returns error if the limiter has been killed already.
@@ -203,7 +822,7 @@ func (s *SyncLimiter) Kill() error {
 	defer s.lock.Unlock()
 
 	if s.killed {
-		return fmt.Errorf("called Kill on already killed limiter")
+		return fmt.Errorf("called Kill on already killed limiter: %w", ErrLimiterKilled)
 	}
 
 	// kill is a dummy implementation for SyncLimiter,
@@ -219,7 +838,17 @@ func (s *SyncLimiter) Kill() error {
 // 1. limit: The number of tasks to be allowd
 //
 // 2. size: duration
-func NewSyncLimiter(limit uint64, size time.Duration) *SyncLimiter {
+//
+// 3. opts: optional parameters, example: WithClock, WithName, WithObserver
+//
+// Returns an error if limit is 0 or size is less than a millisecond.
+func NewSyncLimiter(limit uint64, size time.Duration, opts ...Option) (*SyncLimiter, error) {
+	if limit == 0 || size < time.Millisecond {
+		return nil, ErrInvalidConfig
+	}
+
+	o := newOptions(opts)
+
 	current := NewWindow(0, time.Unix(0, 0))
 	previous := NewWindow(0, time.Unix(0, 0))
 
@@ -230,5 +859,7 @@ func NewSyncLimiter(limit uint64, size time.Duration) *SyncLimiter {
 		killed:   false,
 		size:     size,
 		limit:    limit,
-	}
+		clock:    o.clock,
+		notifier: o.notifier(),
+	}, nil
 }
@@ -1,6 +1,7 @@
 package ratelimiter
 
 import (
+	"context"
 	"fmt"
 	"sync"
 	"testing"
@@ -8,14 +9,14 @@ import (
 )
 
 func TestInvalidLimiterConfiguration(t *testing.T) {
-	limiter := NewDefaultLimiter(10, time.Microsecond*800)
-	if _, err := limiter.ShouldAllow(3); err == nil {
-		t.Fatalf("ShouldAllow() failed, did not throw error when window size <= 1 millisecond")
+	limiter, err := NewDefaultLimiter(10, time.Microsecond*800)
+	if err == nil || limiter != nil {
+		t.Fatalf("NewDefaultLimiter() failed, did not throw error when window size <= 1 millisecond")
 	}
 
-	limiter1 := NewSyncLimiter(0, 10*time.Second)
-	if _, err := limiter1.ShouldAllow(10); err == nil {
-		t.Fatalf("ShouldAllow() failed, did not throw error when limit == 0")
+	limiter1, err := NewSyncLimiter(0, 10*time.Second)
+	if err == nil || limiter1 != nil {
+		t.Fatalf("NewSyncLimiter() failed, did not throw error when limit == 0")
 	}
 }
 
@@ -38,7 +39,7 @@ func TestLimiterAccuracy(t *testing.T) {
 
 	// will be set to true once the go routine completes all `nRuns`
 
-	limiter := NewDefaultLimiter(limit, duration)
+	limiter, _ := NewDefaultLimiter(limit, duration)
 	defer limiter.Kill()
 
 	for i := 0; i < nRuns; i++ {
@@ -86,7 +87,7 @@ func TestConcurrentLimiterAccuracy(t *testing.T) {
 	var limit uint64 = 100
 
 	// create a limiter, that is shared across go routines:
-	sharedLimiter := NewDefaultLimiter(limit, duration)
+	sharedLimiter, _ := NewDefaultLimiter(limit, duration)
 	defer sharedLimiter.Kill()
 
 	// launch N go-routines:
@@ -169,7 +170,7 @@ func TestConcurrentSyncLimiter(t *testing.T) {
 	var limit uint64 = 100
 
 	// create a limiter, that is shared across go routines:
-	sharedLimiter := NewSyncLimiter(limit, duration)
+	sharedLimiter, _ := NewSyncLimiter(limit, duration)
 	defer sharedLimiter.Kill()
 
 	// launch N go-routines:
@@ -254,7 +255,7 @@ func TestLimiterCleanup(t *testing.T) {
 	var limit uint64 = 10
 	var size time.Duration = 5 * time.Second
 
-	limiter := NewDefaultLimiter(limit, size)
+	limiter, _ := NewDefaultLimiter(limit, size)
 
 	// call allow check on limiter:
 	_, err := limiter.ShouldAllow(1)
@@ -283,7 +284,7 @@ func TestSyncLimiterCleanup(t *testing.T) {
 	var limit uint64 = 10
 	var size time.Duration = 5 * time.Second
 
-	limiter := NewSyncLimiter(limit, size)
+	limiter, _ := NewSyncLimiter(limit, size)
 
 	// call allow check on limiter:
 	_, err := limiter.ShouldAllow(1)
@@ -308,8 +309,560 @@ func TestSyncLimiterCleanup(t *testing.T) {
 	}
 }
 
+func TestLimiterWait(t *testing.T) {
+	var limit uint64 = 10
+	size := 100 * time.Millisecond
+
+	defaultLimiter, _ := NewDefaultLimiter(limit, size)
+	syncLimiter, _ := NewSyncLimiter(limit, size)
+
+	limiters := []interface {
+		Limiter
+		Wait(ctx context.Context, n uint64) error
+	}{defaultLimiter, syncLimiter}
+
+	for _, limiter := range limiters {
+		// exhaust the limiter:
+		for {
+			allowed, err := limiter.ShouldAllow(1)
+			if err != nil {
+				t.Fatalf("Error when calling ShouldAllow() on active limiter, Error: %v", err)
+			}
+			if !allowed {
+				break
+			}
+		}
+
+		start := time.Now()
+		if err := limiter.Wait(context.Background(), 5); err != nil {
+			t.Fatalf("Wait() failed on active limiter, Error: %v", err)
+		}
+
+		if elapsed := time.Since(start); elapsed > 3*size {
+			t.Fatalf("Wait() blocked for %v, expected it to return within %v", elapsed, 3*size)
+		}
+
+		// n greater than limit can never be allowed:
+		if err := limiter.Wait(context.Background(), limit+1); err == nil {
+			t.Fatalf("Wait() did not return error when n > limit")
+		}
+
+		// cancelled context must be reported:
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+		if err := limiter.Wait(ctx, limit); err != context.DeadlineExceeded {
+			t.Fatalf("Wait() returned %v, expected %v", err, context.DeadlineExceeded)
+		}
+		cancel()
+
+		limiter.Kill()
+		if err := limiter.Wait(context.Background(), 1); err == nil {
+			t.Fatalf("Calling Wait() on inactive limiter did not throw any errors.")
+		}
+	}
+}
+
+func TestLimiterWaitFIFO(t *testing.T) {
+	limiter, _ := NewSyncLimiter(10, 50*time.Millisecond)
+	defer limiter.Kill()
+
+	if err := limiter.Wait(context.Background(), 10); err != nil {
+		t.Fatalf("Wait() failed on active limiter, Error: %v", err)
+	}
+
+	order := make(chan uint64, 4)
+	wg := sync.WaitGroup{}
+
+	// a large waiter is queued first, followed by smaller ones:
+	for _, n := range []uint64{10, 1, 1, 1} {
+		wg.Add(1)
+		go func(n uint64) {
+			defer wg.Done()
+			if err := limiter.Wait(context.Background(), n); err != nil {
+				t.Errorf("Wait() failed on active limiter, Error: %v", err)
+			}
+			order <- n
+		}(n)
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	wg.Wait()
+	close(order)
+
+	if first := <-order; first != 10 {
+		t.Fatalf("Wait() is not FIFO, expected the large waiter to be served first, got n = %d", first)
+	}
+}
+
+func TestLimiterReserve(t *testing.T) {
+	var limit uint64 = 10
+	size := 200 * time.Millisecond
+
+	defaultLimiter, _ := NewDefaultLimiter(limit, size)
+	syncLimiter, _ := NewSyncLimiter(limit, size)
+
+	limiters := []interface {
+		Limiter
+		Reserve(n uint64) *Reservation
+	}{defaultLimiter, syncLimiter}
+
+	for _, limiter := range limiters {
+		// wait for the background window slider to start:
+		time.Sleep(time.Millisecond)
+
+		first := limiter.Reserve(limit)
+		if !first.OK() || first.Delay() != 0 {
+			t.Fatalf("Reserve() failed, expected immediate reservation, got ok = %v, delay = %v", first.OK(), first.Delay())
+		}
+
+		second := limiter.Reserve(limit)
+		if !second.OK() || second.Delay() == 0 {
+			t.Fatalf("Reserve() failed, expected delayed reservation, got ok = %v, delay = %v", second.OK(), second.Delay())
+		}
+
+		if second.Delay() > 3*size {
+			t.Fatalf("Reserve() failed, delay %v is larger than expected %v", second.Delay(), 3*size)
+		}
+
+		// the reserved capacity must not be available to others:
+		if allowed, _ := limiter.ShouldAllow(1); allowed {
+			t.Fatalf("ShouldAllow() allowed a task while the capacity was reserved")
+		}
+
+		third := limiter.Reserve(1)
+		if third.Delay() < second.Delay() {
+			t.Fatalf("Reserve() is not FIFO, delay %v is smaller than previous delay %v", third.Delay(), second.Delay())
+		}
+
+		if r := limiter.Reserve(limit + 1); r.OK() {
+			t.Fatalf("Reserve() returned a valid reservation when n > limit")
+		}
+
+		limiter.Kill()
+		if r := limiter.Reserve(1); r.OK() {
+			t.Fatalf("Calling Reserve() on inactive limiter returned a valid reservation")
+		}
+	}
+}
+
+func TestLimiterReserveCancel(t *testing.T) {
+	limiter, _ := NewSyncLimiter(10, time.Second)
+	defer limiter.Kill()
+
+	if r := limiter.Reserve(10); !r.OK() {
+		t.Fatalf("Reserve() failed on active limiter")
+	}
+
+	delayed := limiter.Reserve(10)
+	if !delayed.OK() || delayed.Delay() == 0 {
+		t.Fatalf("Reserve() failed, expected delayed reservation, got ok = %v, delay = %v", delayed.OK(), delayed.Delay())
+	}
+
+	// the next reservation must be served after the delayed one:
+	next := limiter.Reserve(10)
+	if next.Delay() <= delayed.Delay() {
+		t.Fatalf("Reserve() failed, delay %v is not larger than previous delay %v", next.Delay(), delayed.Delay())
+	}
+
+	// cancelling gives back the capacity, so the window of the next reservation is empty again
+	// and it can be booked with no more delay than the cancelled one.
+	next.Cancel()
+	delayed.Cancel()
+
+	again := limiter.Reserve(1)
+	if !again.OK() || again.Delay() > next.Delay() {
+		t.Fatalf("Cancel() did not give the reserved capacity back, delay %v", again.Delay())
+	}
+}
+
+func TestLimiterAllowResult(t *testing.T) {
+	var limit uint64 = 10
+	size := time.Second
+
+	defaultLimiter, _ := NewDefaultLimiter(limit, size)
+	syncLimiter, _ := NewSyncLimiter(limit, size)
+
+	limiters := []interface {
+		Limiter
+		Allow(n uint64) (Result, error)
+	}{defaultLimiter, syncLimiter}
+
+	for _, limiter := range limiters {
+		// wait for the background window slider to start:
+		time.Sleep(time.Millisecond)
+
+		result, err := limiter.Allow(4)
+		if err != nil {
+			t.Fatalf("Error when calling Allow() on active limiter, Error: %v", err)
+		}
+
+		if !result.Allowed || result.Limit != limit || result.RetryAfter != 0 {
+			t.Fatalf("Allow() returned unexpected result %+v", result)
+		}
+
+		if result.Remaining > limit-4 {
+			t.Fatalf("Allow() returned %d remaining tasks, expected at most %d", result.Remaining, limit-4)
+		}
+
+		if !result.ResetAt.After(time.Now()) || time.Until(result.ResetAt) > size {
+			t.Fatalf("Allow() returned reset time %v outside of the current window", result.ResetAt)
+		}
+
+		result, err = limiter.Allow(limit)
+		if err != nil {
+			t.Fatalf("Error when calling Allow() on active limiter, Error: %v", err)
+		}
+
+		if result.Allowed || result.RetryAfter <= 0 || result.RetryAfter > 2*size {
+			t.Fatalf("Allow() returned unexpected result %+v for a rejected decision", result)
+		}
+
+		limiter.Kill()
+		if _, err := limiter.Allow(1); err == nil {
+			t.Fatalf("Calling Allow() on inactive limiter did not throw any errors.")
+		}
+	}
+}
+
+func TestLimiterWindowSlide(t *testing.T) {
+	size := time.Second
+	clock := NewManualClock(time.Unix(1000, 0))
+
+	defaultLimiter, _ := NewDefaultLimiter(10, size, WithClock(clock))
+	defer defaultLimiter.Kill()
+
+	syncLimiter, _ := NewSyncLimiter(10, size, WithClock(clock))
+	defer syncLimiter.Kill()
+
+	// waits for the background window slider to slide the window and park on the clock.
+	advance := func(d time.Duration) {
+		clock.BlockUntil(1)
+		clock.Advance(d)
+		clock.BlockUntil(1)
+	}
+
+	check := func(n uint64, expected bool) {
+		for _, limiter := range []Limiter{defaultLimiter, syncLimiter} {
+			allowed, err := limiter.ShouldAllow(n)
+			if err != nil {
+				t.Fatalf("Error when calling ShouldAllow() on active limiter, Error: %v", err)
+			}
+			if allowed != expected {
+				t.Fatalf("ShouldAllow(%d) on %T returned %v, expected %v", n, limiter, allowed, expected)
+			}
+		}
+	}
+
+	// wait for the first window to be started by the background window slider:
+	clock.BlockUntil(1)
+
+	check(10, true)
+	check(1, false)
+
+	// the previous window is fully weighted right after the slide:
+	advance(size)
+	check(1, false)
+
+	// half of the previous window has decayed:
+	advance(size / 2)
+	check(5, true)
+	check(1, false)
+
+	// previous window has slided over:
+	advance(size + size/2)
+	check(5, true)
+}
+
+func TestLimiterReconfigure(t *testing.T) {
+	clock := NewManualClock(time.Unix(1000, 0))
+
+	defaultLimiter, _ := NewDefaultLimiter(10, time.Hour, WithClock(clock))
+	defer defaultLimiter.Kill()
+
+	syncLimiter, _ := NewSyncLimiter(10, time.Hour, WithClock(clock))
+	defer syncLimiter.Kill()
+
+	// wait for the first window to be started by the background window slider:
+	clock.BlockUntil(1)
+
+	limiters := []interface {
+		Limiter
+		SetLimit(limit uint64) error
+		SetSize(size time.Duration) error
+	}{defaultLimiter, syncLimiter}
+
+	for _, limiter := range limiters {
+		if allowed, _ := limiter.ShouldAllow(10); !allowed {
+			t.Fatalf("ShouldAllow() on %T failed to allow tasks within the limit", limiter)
+		}
+
+		if err := limiter.SetLimit(0); err == nil {
+			t.Fatalf("SetLimit() on %T did not return error for limit == 0", limiter)
+		}
+
+		if err := limiter.SetSize(time.Microsecond); err == nil {
+			t.Fatalf("SetSize() on %T did not return error for size < 1 millisecond", limiter)
+		}
+
+		// counted tasks are retained, only the limit is raised:
+		if err := limiter.SetLimit(15); err != nil {
+			t.Fatalf("SetLimit() on %T failed, Error: %v", limiter, err)
+		}
+
+		if allowed, _ := limiter.ShouldAllow(5); !allowed {
+			t.Fatalf("ShouldAllow() on %T did not allow tasks after the limit was raised", limiter)
+		}
+
+		if allowed, _ := limiter.ShouldAllow(1); allowed {
+			t.Fatalf("ShouldAllow() on %T allowed tasks beyond the raised limit", limiter)
+		}
+
+		// counts are rescaled to the new window size, 15 tasks/hour is 0.25 tasks/minute.
+		if err := limiter.SetSize(time.Minute); err != nil {
+			t.Fatalf("SetSize() on %T failed, Error: %v", limiter, err)
+		}
+
+		if allowed, _ := limiter.ShouldAllow(14); !allowed {
+			t.Fatalf("ShouldAllow() on %T did not allow tasks after the window size was shrunk", limiter)
+		}
+	}
+
+	// the new window size takes effect immediately for the background window slider:
+	clock.Advance(2 * time.Minute)
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		result, err := defaultLimiter.Allow(0)
+		if err != nil {
+			t.Fatalf("Error when calling Allow() on active limiter, Error: %v", err)
+		}
+
+		if result.ResetAt.Equal(clock.Now().Add(time.Minute)) {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("DefaultLimiter did not slide the window after the window size was changed")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	defaultLimiter.Kill()
+	if err := defaultLimiter.SetLimit(10); err == nil {
+		t.Fatalf("Calling SetLimit() on inactive limiter did not throw any errors.")
+	}
+}
+
+func TestLimiterReturn(t *testing.T) {
+	size := time.Second
+	clock := NewManualClock(time.Unix(1000, 0))
+
+	defaultLimiter, _ := NewDefaultLimiter(10, size, WithClock(clock))
+	defer defaultLimiter.Kill()
+
+	syncLimiter, _ := NewSyncLimiter(10, size, WithClock(clock))
+	defer syncLimiter.Kill()
+
+	limiters := []interface {
+		Limiter
+		Return(n uint64, chargedAt time.Time)
+	}{defaultLimiter, syncLimiter}
+
+	check := func(n uint64, expected bool) {
+		for _, limiter := range limiters {
+			allowed, err := limiter.ShouldAllow(n)
+			if err != nil {
+				t.Fatalf("Error when calling ShouldAllow() on active limiter, Error: %v", err)
+			}
+			if allowed != expected {
+				t.Fatalf("ShouldAllow(%d) on %T returned %v, expected %v", n, limiter, allowed, expected)
+			}
+		}
+	}
+
+	giveBack := func(n uint64, chargedAt time.Time) {
+		for _, limiter := range limiters {
+			limiter.Return(n, chargedAt)
+		}
+	}
+
+	// wait for the first window to be started by the background window slider:
+	clock.BlockUntil(1)
+
+	check(10, true)
+	giveBack(4, clock.Now())
+	check(4, true)
+	check(1, false)
+
+	// returning more than counted does not underflow:
+	giveBack(100, clock.Now())
+	check(10, true)
+
+	// the window slid after the tasks were counted, they are taken off the previous window,
+	// not off the tasks counted since the slide:
+	chargedAt := clock.Now()
+	clock.Advance(size)
+	clock.BlockUntil(1)
+
+	giveBack(10, chargedAt)
+	check(3, true)
+	giveBack(5, chargedAt)
+	check(1, true)
+
+	for _, windows := range [][2]*Window{{defaultLimiter.previous, defaultLimiter.current}, {syncLimiter.previous, syncLimiter.current}} {
+		if windows[0].count != 0 || windows[1].count != 4 {
+			t.Fatalf("Return() left the windows at prev=%d cur=%d, expected prev=0 cur=4", windows[0].count, windows[1].count)
+		}
+	}
+
+	// tasks counted before the previous window are already out of the sliding window:
+	clock.Advance(size)
+	clock.BlockUntil(1)
+	check(6, true)
+	giveBack(4, chargedAt)
+	check(1, false)
+}
+
+func TestLimiterPeek(t *testing.T) {
+	size := time.Second
+	clock := NewManualClock(time.Unix(1000, 0))
+
+	defaultLimiter, _ := NewDefaultLimiter(10, size, WithClock(clock))
+	defer defaultLimiter.Kill()
+
+	syncLimiter, _ := NewSyncLimiter(10, size, WithClock(clock))
+	defer syncLimiter.Kill()
+
+	limiters := []interface {
+		Limiter
+		Peek(n uint64) (bool, error)
+	}{defaultLimiter, syncLimiter}
+
+	peek := func(n uint64, expected bool) {
+		for _, limiter := range limiters {
+			allowed, err := limiter.Peek(n)
+			if err != nil {
+				t.Fatalf("Error when calling Peek() on active limiter, Error: %v", err)
+			}
+			if allowed != expected {
+				t.Fatalf("Peek(%d) on %T returned %v, expected %v", n, limiter, allowed, expected)
+			}
+		}
+	}
+
+	// wait for the first window to be started by the background window slider:
+	clock.BlockUntil(1)
+
+	// peeking does not count the tasks:
+	peek(10, true)
+	peek(10, true)
+	peek(11, false)
+
+	for _, limiter := range limiters {
+		limiter.ShouldAllow(6)
+	}
+
+	peek(4, true)
+	peek(5, false)
+
+	// half of the previous window has decayed, SyncLimiter slides it's windows only on ShouldAllow:
+	clock.Advance(size)
+	clock.BlockUntil(1)
+	clock.Advance(size / 2)
+	peek(7, true)
+	peek(8, false)
+
+	for _, limiter := range limiters {
+		if allowed, _ := limiter.ShouldAllow(7); !allowed {
+			t.Fatalf("ShouldAllow(7) on %T did not allow the tasks Peek() reported as allowed", limiter)
+		}
+	}
+
+	syncLimiter.Kill()
+	if _, err := syncLimiter.Peek(1); err == nil {
+		t.Fatalf("Calling Peek() on inactive limiter did not throw any errors.")
+	}
+}
+
+func TestLimiterConsume(t *testing.T) {
+	size := time.Second
+	clock := NewManualClock(time.Unix(1000, 0))
+
+	defaultLimiter, _ := NewDefaultLimiter(10, size, WithClock(clock))
+	defer defaultLimiter.Kill()
+
+	syncLimiter, _ := NewSyncLimiter(10, size, WithClock(clock))
+	defer syncLimiter.Kill()
+
+	limiters := []interface {
+		Limiter
+		Consume(n uint64) (uint64, error)
+	}{defaultLimiter, syncLimiter}
+
+	check := func(n uint64, expected bool) {
+		for _, limiter := range limiters {
+			allowed, err := limiter.ShouldAllow(n)
+			if err != nil {
+				t.Fatalf("Error when calling ShouldAllow() on active limiter, Error: %v", err)
+			}
+			if allowed != expected {
+				t.Fatalf("ShouldAllow(%d) on %T returned %v, expected %v", n, limiter, allowed, expected)
+			}
+		}
+	}
+
+	// wait for the first window to be started by the background window slider:
+	clock.BlockUntil(1)
+
+	for _, limiter := range limiters {
+		if debt, err := limiter.Consume(6); debt != 0 || err != nil {
+			t.Fatalf("Consume(6) on %T returned (%d, %v), expected (0, nil)", limiter, debt, err)
+		}
+
+		// the tasks are counted beyond the limit:
+		if debt, err := limiter.Consume(9); debt != 5 || err != nil {
+			t.Fatalf("Consume(9) on %T returned (%d, %v), expected (5, nil)", limiter, debt, err)
+		}
+	}
+
+	check(1, false)
+
+	// the previous window is fully weighted right after the slide:
+	clock.Advance(size)
+	clock.BlockUntil(1)
+	check(1, false)
+
+	// half of the overdraft has decayed:
+	clock.Advance(size / 2)
+	check(3, true)
+	check(1, false)
+
+	syncLimiter.Kill()
+	if _, err := syncLimiter.Consume(1); err == nil {
+		t.Fatalf("Calling Consume() on inactive limiter did not throw any errors.")
+	}
+}
+
+func TestSlidingCountLateSlide(t *testing.T) {
+	start := time.Unix(1000, 0)
+	previous, current := NewWindow(10, start.Add(-time.Second)), NewWindow(3, start)
+
+	// the current window is over but was not slid yet, the previous window no longer overlaps:
+	if used := slidingCount(previous, current, start.Add(1500*time.Millisecond), time.Second); used != 3 {
+		t.Fatalf("slidingCount() returned %d when the slide is late, expected 3", used)
+	}
+
+	if used := debt(previous, current, start.Add(1500*time.Millisecond), time.Second, 2); used != 1 {
+		t.Fatalf("debt() returned %d when the slide is late, expected 1", used)
+	}
+
+	// the clock read before the current window started, the previous window fully overlaps:
+	if used := slidingCount(previous, current, start.Add(-time.Millisecond), time.Second); used != 13 {
+		t.Fatalf("slidingCount() returned %d before the current window started, expected 13", used)
+	}
+}
+
 func BenchmarkDefaultLimiter(b *testing.B) {
-	limiter := NewDefaultLimiter(100, 1*time.Second)
+	limiter, _ := NewDefaultLimiter(100, 1*time.Second)
 
 	for i := 0; i < b.N; i++ {
 		_, err := limiter.ShouldAllow(1)
@@ -320,7 +873,7 @@ func BenchmarkDefaultLimiter(b *testing.B) {
 }
 
 func BenchmarkSyncLimiter(b *testing.B) {
-	limiter := NewSyncLimiter(100, 1*time.Second)
+	limiter, _ := NewSyncLimiter(100, 1*time.Second)
 
 	for i := 0; i < b.N; i++ {
 		_, err := limiter.ShouldAllow(1)
@@ -331,7 +884,7 @@ func BenchmarkSyncLimiter(b *testing.B) {
 }
 
 func BenchmarkConcurrentDefaultLimiter(b *testing.B) {
-	limiter := NewDefaultLimiter(100, 1*time.Second)
+	limiter, _ := NewDefaultLimiter(100, 1*time.Second)
 
 	b.RunParallel(func(p *testing.PB) {
 		for p.Next() {
@@ -344,7 +897,7 @@ func BenchmarkConcurrentDefaultLimiter(b *testing.B) {
 }
 
 func BenchmarkConcurrentSyncLimiter(b *testing.B) {
-	limiter := NewSyncLimiter(100, 1*time.Second)
+	limiter, _ := NewSyncLimiter(100, 1*time.Second)
 
 	b.RunParallel(func(p *testing.PB) {
 		for p.Next() {
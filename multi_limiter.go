@@ -0,0 +1,191 @@
+package ratelimiter
+
+import (
+	"fmt"
+	"sync"
+)
+
+// refunder is implemented by limiters that can give back the tasks they counted moments ago,
+// it is used to roll back a decision when another limiter rejects the tasks.
+type refunder interface {
+	refund(n uint64)
+}
+
+// quietLimiter is implemented by limiters that can make a decision without notifying their observer,
+// the observers of the limiters combined by a MultiLimiter are notified only once all of them allowed
+// the tasks, so that the tasks rolled back are not reported as allowed.
+type quietLimiter interface {
+	allowResult(n uint64, notify bool) (Result, error)
+	observer() notifier
+}
+
+// MultiResult is the Result of the binding limiter of a MultiLimiter, along with it's index.
+type MultiResult struct {
+	Result
+	// Binding is the index (in the order passed to NewMultiLimiter) of the limiter that rejected
+	// the tasks, or the one with the least Remaining tasks if they were allowed.
+	Binding int
+}
+
+// MultiLimiter combines several limiters, example: 10 tasks per second, 500 per minute and 20k per
+// day. Tasks are allowed only if every limiter allows them, nothing is counted otherwise. Limiters
+// that can't give back the tasks they counted (i.e not created by this package) are checked last,
+// so only one of them can be used safely.
+// The observers of the combined limiters are notified only once the decision is final, so the
+// tasks rolled back are not reported as allowed. A MultiLimiter without limiters allows every task.
+type MultiLimiter struct {
+	lock     sync.Mutex
+	limiters []Limiter
+	order    []int
+	killed   bool
+}
+
+// allowAll checks the limiters in the given order and rolls back the ones that
+// counted the tasks if a later one rejects them. The tasks are allowed if there is no limiter.
+func allowAll(limiters []Limiter, order []int, n uint64) (MultiResult, error) {
+	best := MultiResult{Result: Result{Allowed: true}, Binding: -1}
+	bestDescribed := false
+
+	// observers of the limiters that allowed the tasks, notified once every limiter allowed them.
+	observers := make([]notifier, 0, len(order))
+
+	for checked, idx := range order {
+		limiter := limiters[idx]
+
+		var result Result
+		var err error
+
+		resultLimiter, describes := limiter.(resultLimiter)
+		quiet, isQuiet := limiter.(quietLimiter)
+		switch {
+		case isQuiet:
+			result, err = quiet.allowResult(n, false)
+		case describes:
+			result, err = resultLimiter.Allow(n)
+		default:
+			result.Allowed, err = limiter.ShouldAllow(n)
+		}
+
+		if err != nil || !result.Allowed {
+			if isQuiet && err == nil {
+				quiet.observer().notify(n, false)
+			}
+
+			rollback(limiters, order[:checked], n)
+			return MultiResult{Result: result, Binding: idx}, err
+		}
+
+		if isQuiet {
+			observers = append(observers, quiet.observer())
+		}
+
+		// limiters that can't describe their state are binding only if no other limiter can.
+		if best.Binding < 0 || (describes && (!bestDescribed || result.Remaining < best.Remaining)) {
+			best = MultiResult{Result: result, Binding: idx}
+			bestDescribed = describes
+		}
+	}
+
+	for _, observer := range observers {
+		observer.notify(n, true)
+	}
+
+	return best, nil
+}
+
+// rollback gives back n tasks to the limiters at the given indices.
+func rollback(limiters []Limiter, indices []int, n uint64) {
+	for _, idx := range indices {
+		if refunder, ok := limiters[idx].(refunder); ok {
+			refunder.refund(n)
+		}
+	}
+}
+
+// ShouldAllow makes decison whether n tasks can be allowed by all the limiters or not.
+//
+// Parameters:
+//
+// 1. n: number of tasks to be processed, set this as 1 for a single task. (Example: An HTTP request)
+//
+// Returns (bool, error). (false, error) if any of the limiters is inactive (or it is killed). Otherwise,
+// (true/false, nil) depending on whether n tasks can be allowed or not.
+func (m *MultiLimiter) ShouldAllow(n uint64) (bool, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if m.killed {
+		return false, fmt.Errorf("function ShouldAllow called on an inactive instance: %w", ErrLimiterKilled)
+	}
+
+	result, err := allowAll(m.limiters, m.order, n)
+	return result.Allowed, err
+}
+
+// Allow makes decison whether n tasks can be allowed by all the limiters or not, just like
+// ShouldAllow, and describes the state of the binding limiter after the decision.
+//
+// Parameters:
+//
+// 1. n: number of tasks to be processed, set this as 1 for a single task. (Example: An HTTP request)
+//
+// Returns (MultiResult, error). (MultiResult, error) with the index of the failing limiter if any of
+// the limiters is inactive (or it is killed). Otherwise, (MultiResult, nil) where MultiResult.Allowed
+// is true/false depending on whether n tasks can be allowed or not.
+func (m *MultiLimiter) Allow(n uint64) (MultiResult, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if m.killed {
+		return MultiResult{Binding: -1}, fmt.Errorf("function Allow called on an inactive instance: %w", ErrLimiterKilled)
+	}
+
+	return allowAll(m.limiters, m.order, n)
+}
+
+// Kill the limiter along with all the limiters it combines, returns error if the limiter
+// has been killed already.
+func (m *MultiLimiter) Kill() error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if m.killed {
+		return fmt.Errorf("called Kill on already killed limiter: %w", ErrLimiterKilled)
+	}
+
+	m.killed = true
+	for _, limiter := range m.limiters {
+		limiter.Kill()
+	}
+
+	return nil
+}
+
+// NewMultiLimiter creates an instance of MultiLimiter and returns it's pointer.
+//
+// Parameters:
+//
+// 1. limiters: The limiters to be combined, example: NewSyncLimiter(10, time.Second), NewSyncLimiter(500, time.Minute)
+func NewMultiLimiter(limiters ...Limiter) *MultiLimiter {
+	order := make([]int, 0, len(limiters))
+
+	// limiters that can't be rolled back are checked last.
+	for idx, limiter := range limiters {
+		if _, ok := limiter.(refunder); ok {
+			order = append(order, idx)
+		}
+	}
+
+	for idx, limiter := range limiters {
+		if _, ok := limiter.(refunder); !ok {
+			order = append(order, idx)
+		}
+	}
+
+	return &MultiLimiter{
+		lock:     sync.Mutex{},
+		limiters: limiters,
+		order:    order,
+		killed:   false,
+	}
+}
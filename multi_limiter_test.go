@@ -0,0 +1,161 @@
+package ratelimiter
+
+import (
+	"testing"
+	"time"
+)
+
+// countingLimiter is a Limiter that can't give back the tasks it counted.
+type countingLimiter struct {
+	limit uint64
+	count uint64
+}
+
+func (c *countingLimiter) ShouldAllow(n uint64) (bool, error) {
+	if c.count+n > c.limit {
+		return false, nil
+	}
+
+	c.count += n
+	return true, nil
+}
+
+func (c *countingLimiter) Kill() error {
+	return nil
+}
+
+func TestMultiLimiter(t *testing.T) {
+	clock := NewManualClock(time.Unix(1000, 0))
+
+	perSecond, _ := NewSyncLimiter(10, time.Second, WithClock(clock))
+	perMinute, _ := NewSyncLimiter(15, time.Minute, WithClock(clock))
+	limiter := NewMultiLimiter(perSecond, perMinute)
+
+	result, err := limiter.Allow(8)
+	if err != nil {
+		t.Fatalf("Error when calling Allow() on active limiter, Error: %v", err)
+	}
+
+	// the per-second limiter has the least remaining tasks:
+	if !result.Allowed || result.Binding != 0 || result.Remaining != 2 {
+		t.Fatalf("Allow(8) returned unexpected result %+v", result)
+	}
+
+	// rejected by the per-second limiter, nothing is counted:
+	result, _ = limiter.Allow(3)
+	if result.Allowed || result.Binding != 0 {
+		t.Fatalf("Allow(3) returned unexpected result %+v", result)
+	}
+
+	clock.Advance(2 * time.Second)
+
+	// rejected by the per-minute limiter after the per-second one counted the tasks:
+	result, _ = limiter.Allow(8)
+	if result.Allowed || result.Binding != 1 {
+		t.Fatalf("Allow(8) returned unexpected result %+v", result)
+	}
+
+	// the per-second limiter was rolled back:
+	if allowed, _ := perSecond.ShouldAllow(10); !allowed {
+		t.Fatalf("tasks counted by the per-second limiter were not rolled back")
+	}
+
+	limiter.Kill()
+	if _, err := limiter.ShouldAllow(1); err == nil {
+		t.Fatalf("Calling ShouldAllow() on inactive limiter did not throw any errors.")
+	}
+
+	if _, err := perMinute.ShouldAllow(1); err == nil {
+		t.Fatalf("Kill() did not kill the combined limiters")
+	}
+}
+
+func TestMultiLimiterRollback(t *testing.T) {
+	clock := NewManualClock(time.Unix(1000, 0))
+
+	// the custom limiter can't be rolled back, so it is checked last.
+	custom := &countingLimiter{limit: 2}
+	tokenBucketLimiter, _ := NewTokenBucketLimiter(5, time.Second, WithClock(clock))
+	gcraLimiter, _ := NewGCRALimiter(5, time.Second, WithClock(clock))
+	slidingLogLimiter, _ := NewSlidingLogLimiter(5, time.Second, WithClock(clock))
+	fixedWindowLimiter, _ := NewFixedWindowLimiter(5, time.Second, WithClock(clock))
+	concurrencyLimiter, _ := NewConcurrencyLimiter(5)
+
+	limiters := []Limiter{
+		custom, tokenBucketLimiter, gcraLimiter,
+		slidingLogLimiter, fixedWindowLimiter, concurrencyLimiter,
+	}
+
+	limiter := NewMultiLimiter(limiters...)
+	result, _ := limiter.Allow(3)
+	if result.Allowed || result.Binding != 0 {
+		t.Fatalf("Allow(3) returned unexpected result %+v", result)
+	}
+
+	// every other limiter was rolled back:
+	for idx, limiter := range limiters[1:] {
+		if allowed, _ := limiter.ShouldAllow(5); !allowed {
+			t.Fatalf("limiter %d was not rolled back", idx+1)
+		}
+	}
+}
+
+func TestMultiLimiterObserver(t *testing.T) {
+	clock := NewManualClock(time.Unix(1000, 0))
+
+	allowed := map[string]uint64{}
+	rejected := map[string]uint64{}
+	observer := func(name string, n uint64, isAllowed bool) {
+		if isAllowed {
+			allowed[name] += n
+		} else {
+			rejected[name] += n
+		}
+	}
+
+	perSecond, _ := NewSyncLimiter(10, time.Second, WithClock(clock), WithName("second"), WithObserver(observer))
+	perMinute, _ := NewSyncLimiter(15, time.Minute, WithClock(clock), WithName("minute"), WithObserver(observer))
+	limiter := NewMultiLimiter(perSecond, perMinute)
+
+	limiter.ShouldAllow(8)
+	clock.Advance(2 * time.Second)
+
+	// counted by the per-second limiter, then rolled back when the per-minute one rejects them:
+	limiter.ShouldAllow(8)
+
+	if allowed["second"] != 8 || allowed["minute"] != 8 {
+		t.Fatalf("observer was notified of allowed tasks %v, expected 8 per limiter", allowed)
+	}
+
+	if rejected["second"] != 0 || rejected["minute"] != 8 {
+		t.Fatalf("observer was notified of rejected tasks %v, expected 8 by the per-minute limiter", rejected)
+	}
+}
+
+func TestMultiLimiterEmpty(t *testing.T) {
+	limiter := NewMultiLimiter()
+
+	result, err := limiter.Allow(1)
+	if err != nil {
+		t.Fatalf("Error when calling Allow() on active limiter, Error: %v", err)
+	}
+
+	if !result.Allowed || result.Binding != -1 {
+		t.Fatalf("Allow(1) returned unexpected result %+v", result)
+	}
+
+	if allowed, _ := limiter.ShouldAllow(1); !allowed {
+		t.Fatalf("MultiLimiter without limiters rejected the tasks")
+	}
+}
+
+func BenchmarkMultiLimiter(b *testing.B) {
+	perSecond, _ := NewSyncLimiter(uint64(b.N), time.Second)
+	perMinute, _ := NewSyncLimiter(uint64(b.N), time.Minute)
+	perDay, _ := NewSyncLimiter(uint64(b.N), 24*time.Hour)
+	limiter := NewMultiLimiter(perSecond, perMinute, perDay)
+
+	for i := 0; i < b.N; i++ {
+		limiter.ShouldAllow(1)
+	}
+}
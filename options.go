@@ -0,0 +1,174 @@
+package ratelimiter
+
+import (
+	"time"
+)
+
+// Observer is notified of the decisions made by a limiter, example: to export metrics. It is
+// called synchronously while the limiter is locked, so it must be fast and must not use the limiter.
+//
+// Parameters:
+//
+// 1. name: the name of the limiter set by WithName, or the key for the limiters of an AttributeBasedLimiter.
+//
+// 2. n: number of tasks.
+//
+// 3. allowed: true if the tasks were allowed.
+type Observer func(name string, n uint64, allowed bool)
+
+// DefaultShards is the number of shards used by AttributeBasedLimiter unless WithShards is used.
+const DefaultShards = 32
+
+// options holds the optional configuration shared by the limiters.
+type options struct {
+	clock       Clock
+	limiterType LimiterType
+	location    *time.Location
+	burst       uint64
+	name        string
+	observer    Observer
+	shards      int
+	idleTTL     time.Duration
+
+	maxKeys          int
+	saturationPolicy SaturationPolicy
+	overflow         Limiter
+
+	factory LimiterFactory
+}
+
+// Option configures optional parameters of a limiter, options are passed
+// to the constructors like NewDefaultLimiter and NewAttributeBasedLimiter.
+type Option func(*options)
+
+// WithClock sets the Clock used by the limiter to measure time, by default the
+// limiters use the system clock.
+func WithClock(clock Clock) Option {
+	return func(o *options) {
+		o.clock = clock
+	}
+}
+
+// WithLimiterType sets the type of the limiters created for the keys of an AttributeBasedLimiter,
+// by default the sliding window limiters are used.
+func WithLimiterType(limiterType LimiterType) Option {
+	return func(o *options) {
+		o.limiterType = limiterType
+	}
+}
+
+// WithLimiterFactory sets the function creating the limiters of the keys of an AttributeBasedLimiter,
+// it takes precedence over WithLimiterType and backgroundSliding.
+func WithLimiterFactory(factory LimiterFactory) Option {
+	return func(o *options) {
+		o.factory = factory
+	}
+}
+
+// WithLocation sets the location whose wall clock is used to align the windows of
+// FixedWindowLimiter, by default the windows are aligned in UTC. The location can't be nil.
+func WithLocation(location *time.Location) Option {
+	return func(o *options) {
+		o.location = location
+	}
+}
+
+// WithBurst sets the number of tasks TokenBucketLimiter and GCRALimiter allow at once,
+// by default it is the same as the limit.
+func WithBurst(burst uint64) Option {
+	return func(o *options) {
+		o.burst = burst
+	}
+}
+
+// WithName sets the name passed to the Observer of the limiter. The limiters created for
+// the keys of an AttributeBasedLimiter are named after the key by default.
+func WithName(name string) Option {
+	return func(o *options) {
+		o.name = name
+	}
+}
+
+// WithObserver sets the Observer notified of the decisions made by the limiter.
+func WithObserver(observer Observer) Option {
+	return func(o *options) {
+		o.observer = observer
+	}
+}
+
+// WithShards sets the number of shards the keys of an AttributeBasedLimiter are spread over, keys
+// of different shards never contend on a lock. By default DefaultShards shards are used.
+func WithShards(shards int) Option {
+	return func(o *options) {
+		o.shards = shards
+	}
+}
+
+// WithIdleTTL makes AttributeBasedLimiter evict the keys whose windows have been empty for ttl, their
+// limiters are killed by a janitor goroutine which is stopped by Close. By default the keys are never evicted.
+func WithIdleTTL(ttl time.Duration) Option {
+	return func(o *options) {
+		o.idleTTL = ttl
+	}
+}
+
+// WithMaxKeys bounds the number of keys an AttributeBasedLimiter holds, what happens to new keys
+// once it is full is set by WithSaturationPolicy, the coldest keys are evicted by default. The bound
+// applies to the limiter as a whole, the coldest key is evicted from the shard of the new key, or from
+// another shard if it has no key. By default the number of keys is not bounded.
+func WithMaxKeys(maxKeys int) Option {
+	return func(o *options) {
+		o.maxKeys = maxKeys
+	}
+}
+
+// WithSaturationPolicy sets what an AttributeBasedLimiter bounded by WithMaxKeys does with new keys once
+// it is full, example: EvictColdest, RejectNewKeys or UseOverflowLimiter. UseOverflowLimiter needs
+// WithOverflowLimiter too, otherwise it behaves like RejectNewKeys.
+func WithSaturationPolicy(policy SaturationPolicy) Option {
+	return func(o *options) {
+		o.saturationPolicy = policy
+	}
+}
+
+// WithOverflowLimiter sets the limiter shared by the keys that could not be created by MustShouldAllow
+// under the UseOverflowLimiter policy. The limiter is not killed along with the AttributeBasedLimiter.
+// It is ignored under the other policies.
+func WithOverflowLimiter(limiter Limiter) Option {
+	return func(o *options) {
+		o.overflow = limiter
+	}
+}
+
+// notifier notifies the Observer of a limiter, if it has one.
+type notifier struct {
+	name     string
+	observer Observer
+}
+
+func (o options) notifier() notifier {
+	return notifier{name: o.name, observer: o.observer}
+}
+
+func (nt notifier) notify(n uint64, allowed bool) {
+	if nt.observer != nil {
+		nt.observer(nt.name, n, allowed)
+	}
+}
+
+func newOptions(opts []Option) options {
+	o := options{
+		clock:    realClock{},
+		location: time.UTC,
+	}
+
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	if o.shards < 1 {
+		o.shards = DefaultShards
+	}
+
+	return o
+}
@@ -0,0 +1,62 @@
+package ratelimiter
+
+import (
+	"testing"
+	"time"
+)
+
+type decision struct {
+	name    string
+	n       uint64
+	allowed bool
+}
+
+func TestWithObserver(t *testing.T) {
+	var decisions []decision
+	observer := func(name string, n uint64, allowed bool) {
+		decisions = append(decisions, decision{name, n, allowed})
+	}
+
+	limiter, err := NewSyncLimiter(10, time.Second, WithName("api"), WithObserver(observer))
+	if err != nil {
+		t.Fatalf("NewSyncLimiter() failed, Error: %v", err)
+	}
+
+	limiter.ShouldAllow(8)
+	limiter.Allow(3)
+
+	expected := []decision{{"api", 8, true}, {"api", 3, false}}
+	if len(decisions) != len(expected) || decisions[0] != expected[0] || decisions[1] != expected[1] {
+		t.Fatalf("Observer was notified of %v, expected %v", decisions, expected)
+	}
+
+	// the limiters of an AttributeBasedLimiter are named after the key:
+	decisions = nil
+	attributeLimiter := NewAttributeBasedLimiter(false, WithLimiterType(TokenBucket), WithObserver(observer))
+	attributeLimiter.CreateNewKey("key", 5, time.Second)
+	attributeLimiter.ShouldAllow("key", 5)
+
+	if len(decisions) != 1 || decisions[0] != (decision{"key", 5, true}) {
+		t.Fatalf("Observer was notified of %v, expected the decision of key", decisions)
+	}
+}
+
+func TestWithBurst(t *testing.T) {
+	clock := NewManualClock(time.Unix(1000, 0))
+
+	tokenBucketLimiter, _ := NewTokenBucketLimiter(10, time.Second, WithClock(clock))
+	gcraLimiter, _ := NewGCRALimiter(10, time.Second, WithClock(clock), WithBurst(2))
+
+	// the burst is the limit by default:
+	if allowed, _ := tokenBucketLimiter.ShouldAllow(10); !allowed {
+		t.Fatalf("TokenBucketLimiter did not allow a burst of limit tasks")
+	}
+
+	if allowed, _ := gcraLimiter.ShouldAllow(3); allowed {
+		t.Fatalf("GCRALimiter allowed tasks beyond the burst set by WithBurst")
+	}
+
+	if allowed, _ := gcraLimiter.ShouldAllow(2); !allowed {
+		t.Fatalf("GCRALimiter did not allow the burst set by WithBurst")
+	}
+}
@@ -0,0 +1,182 @@
+package ratelimiter
+
+import (
+	"fmt"
+	"time"
+)
+
+// Policy is a named configuration shared by the keys of an AttributeBasedLimiter,
+// example: "free" allowing 100 tasks per minute and "pro" allowing 5000 tasks per minute.
+type Policy struct {
+	Name  string
+	Limit uint64
+	Size  time.Duration
+}
+
+// PolicyResolver returns the policy of a key that is not present, the key is created from the
+// policy registered with the same name. Keys resolved to a policy without a name are not created.
+type PolicyResolver func(key string) Policy
+
+func (p Policy) validate() error {
+	if p.Name == "" || p.Limit == 0 || p.Size < time.Millisecond {
+		return ErrInvalidConfig
+	}
+
+	return nil
+}
+
+// SetPolicy registers the policy, or changes the configuration of the registered policy with the same
+// name along with all the keys created from it, without losing the tasks already counted by them.
+//
+// Parameters:
+//
+// 1. policy: the policy, example: Policy{Name: "free", Limit: 100, Size: time.Minute}
+//
+// Returns an error if the policy has no name, the configuration is invalid or the limiter of a key
+// created from the policy can not be reconfigured.
+func (a *AttributeBasedLimiter) SetPolicy(policy Policy) error {
+	if err := policy.validate(); err != nil {
+		return err
+	}
+
+	a.policyLock.Lock()
+	defer a.policyLock.Unlock()
+
+	a.policies[policy.Name] = policy
+
+	var firstErr error
+	for _, shard := range a.shards {
+		shard.m.Lock()
+		for key, entry := range shard.entries {
+			if entry.policy != policy.Name {
+				continue
+			}
+
+			if err := reconfigure(key, entry.limiter, policy.Limit, policy.Size); err != nil {
+				if firstErr == nil {
+					firstErr = err
+				}
+				continue
+			}
+
+			entry.size = policy.Size
+		}
+		shard.m.Unlock()
+	}
+
+	return firstErr
+}
+
+// GetPolicy returns the registered policy with the name.
+//
+// Parameters:
+//
+// 1. name: name of the policy, example: "free"
+//
+// Returns (Policy, bool), the bool is false if there is no policy with the name.
+func (a *AttributeBasedLimiter) GetPolicy(name string) (Policy, bool) {
+	a.policyLock.RLock()
+	defer a.policyLock.RUnlock()
+
+	policy, ok := a.policies[name]
+	return policy, ok
+}
+
+// SetPolicyResolver sets the function resolving the policy of the keys that are not present, they are then
+// created on demand by ShouldAllow, Allow and Consume. Peek answers for them from their policy without
+// creating them. Unregistered policies returned by the resolver are registered the first time a key is
+// created from them. Pass nil to stop creating keys on demand.
+//
+// Parameters:
+//
+// 1. resolver: function returning the policy of a key, example: based on the plan of a user.
+func (a *AttributeBasedLimiter) SetPolicyResolver(resolver PolicyResolver) {
+	a.policyLock.Lock()
+	defer a.policyLock.Unlock()
+
+	a.resolver = resolver
+}
+
+// CreateKeyWithPolicy create a new key-limiter assiociation configured by the registered policy,
+// the key follows the changes made to the policy by SetPolicy.
+//
+// Parameters:
+//
+// 1. key: a unique key string, example: IP address, token, uuid etc
+//
+// 2. name: name of a registered policy, example: "free"
+//
+// Returns error if the key already exists, the policy is not registered or the key can't be
+// created because of WithMaxKeys.
+func (a *AttributeBasedLimiter) CreateKeyWithPolicy(key string, name string) error {
+	a.policyLock.RLock()
+	defer a.policyLock.RUnlock()
+
+	policy, ok := a.policies[name]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrPolicyNotFound, name)
+	}
+
+	_, err := a.createNewKey(key, policy.Limit, policy.Size, policy.Name)
+	return err
+}
+
+// resolveLimiter returns the limiter of the key, creating it from the policy returned by the resolver
+// if the key is not present.
+func (a *AttributeBasedLimiter) resolveLimiter(key string) (Limiter, error) {
+	limiter, err := a.getLimiter(key)
+	if err == nil {
+		return limiter, nil
+	}
+
+	policy, err := a.resolvePolicy(key, err, true)
+	if err != nil {
+		return nil, err
+	}
+
+	// keys are created with the policy read-locked, so that they don't miss a change made to it meanwhile.
+	a.policyLock.RLock()
+	defer a.policyLock.RUnlock()
+
+	if current, ok := a.policies[policy.Name]; ok {
+		policy = current
+	}
+
+	return a.getOrCreateLimiter(key, policy.Limit, policy.Size, policy.Name, true)
+}
+
+// resolvePolicy returns the policy of the key that is not present, the policy registered with the name
+// returned by the resolver is used if any. The resolved policy is registered if register is true.
+// notFound is returned if there is no resolver or the key is resolved to a policy without a name.
+func (a *AttributeBasedLimiter) resolvePolicy(key string, notFound error, register bool) (Policy, error) {
+	a.policyLock.RLock()
+	resolver := a.resolver
+	a.policyLock.RUnlock()
+
+	if resolver == nil {
+		return Policy{}, notFound
+	}
+
+	// the resolver is called without the lock held, so that it can use the limiter.
+	resolved := resolver(key)
+	if resolved.Name == "" {
+		return Policy{}, notFound
+	}
+
+	a.policyLock.Lock()
+	defer a.policyLock.Unlock()
+
+	if policy, ok := a.policies[resolved.Name]; ok {
+		return policy, nil
+	}
+
+	if err := resolved.validate(); err != nil {
+		return Policy{}, err
+	}
+
+	if register {
+		a.policies[resolved.Name] = resolved
+	}
+
+	return resolved, nil
+}
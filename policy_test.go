@@ -0,0 +1,118 @@
+package ratelimiter
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAttributeBasedLimiterPolicies(t *testing.T) {
+	clock := NewManualClock(time.Unix(1000, 0))
+	attributeLimiter := NewAttributeBasedLimiter(false, WithClock(clock))
+
+	if err := attributeLimiter.SetPolicy(Policy{Name: "free", Limit: 0, Size: time.Minute}); err == nil {
+		t.Fatalf("SetPolicy() did not return error for invalid configuration")
+	}
+
+	free := Policy{Name: "free", Limit: 2, Size: time.Minute}
+	attributeLimiter.SetPolicy(free)
+
+	if policy, ok := attributeLimiter.GetPolicy("free"); !ok || policy != free {
+		t.Fatalf("GetPolicy(free) returned (%+v, %v)", policy, ok)
+	}
+
+	if err := attributeLimiter.CreateKeyWithPolicy("alice", "enterprise"); !errors.Is(err, ErrPolicyNotFound) {
+		t.Fatalf("CreateKeyWithPolicy() returned %v for unknown policy, expected %v", err, ErrPolicyNotFound)
+	}
+
+	if err := attributeLimiter.CreateKeyWithPolicy("alice", "free"); err != nil {
+		t.Fatalf("CreateKeyWithPolicy() returned error %v", err)
+	}
+
+	// keys are not created on demand without a resolver:
+	if _, err := attributeLimiter.ShouldAllow("pro:bob", 1); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("ShouldAllow() returned %v for non-existing key, expected %v", err, ErrKeyNotFound)
+	}
+
+	attributeLimiter.SetPolicyResolver(func(key string) Policy {
+		switch {
+		case strings.HasPrefix(key, "pro:"):
+			return Policy{Name: "pro", Limit: 5, Size: time.Minute}
+		case strings.HasPrefix(key, "free:"):
+			return Policy{Name: "free"}
+		}
+		return Policy{}
+	})
+
+	check := func(key string, n uint64, expected bool) {
+		allowed, err := attributeLimiter.ShouldAllow(key, n)
+		if err != nil {
+			t.Fatalf("ShouldAllow(%s, %d) returned error %v", key, n, err)
+		}
+		if allowed != expected {
+			t.Fatalf("ShouldAllow(%s, %d) returned %v, expected %v", key, n, allowed, expected)
+		}
+	}
+
+	// unregistered policies are registered, registered policies are used by name:
+	check("pro:bob", 5, true)
+	check("pro:bob", 1, false)
+	check("free:carol", 2, true)
+	check("free:carol", 1, false)
+
+	if _, ok := attributeLimiter.GetPolicy("pro"); !ok {
+		t.Fatalf("policy returned by the resolver was not registered")
+	}
+
+	if _, err := attributeLimiter.ShouldAllow("guest", 1); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("ShouldAllow() returned %v for key without a policy, expected %v", err, ErrKeyNotFound)
+	}
+
+	// changing the policy changes all the keys using it, counted tasks are retained:
+	attributeLimiter.ShouldAllow("alice", 2)
+	if err := attributeLimiter.SetPolicy(Policy{Name: "free", Limit: 3, Size: time.Minute}); err != nil {
+		t.Fatalf("SetPolicy() returned error %v when updating the policy", err)
+	}
+
+	check("alice", 1, true)
+	check("alice", 1, false)
+	check("free:carol", 1, true)
+	check("free:carol", 1, false)
+
+	// keys updated explicitly no longer follow the policy:
+	attributeLimiter.UpdateKey("alice", 10, time.Minute)
+	attributeLimiter.SetPolicy(Policy{Name: "free", Limit: 1, Size: time.Minute})
+	check("alice", 5, true)
+}
+
+func TestAttributeBasedLimiterPolicyPeek(t *testing.T) {
+	attributeLimiter := NewAttributeBasedLimiter(false, WithMaxKeys(1))
+	attributeLimiter.SetPolicyResolver(func(key string) Policy {
+		return Policy{Name: "free", Limit: 5, Size: time.Minute}
+	})
+
+	attributeLimiter.ShouldAllow("tenant", 5)
+
+	// peeking at a key that is not present answers from it's policy without creating it:
+	if allowed, err := attributeLimiter.Peek("probe", 5); !allowed || err != nil {
+		t.Fatalf("Peek(probe, 5) returned (%v, %v), expected (true, nil)", allowed, err)
+	}
+
+	if allowed, _ := attributeLimiter.Peek("probe", 6); allowed {
+		t.Fatalf("Peek(probe, 6) returned true beyond the limit of the policy")
+	}
+
+	if attributeLimiter.HasKey("probe") || !attributeLimiter.HasKey("tenant") {
+		t.Fatalf("Peek() created a key or evicted another key")
+	}
+
+	if allowed, _ := attributeLimiter.ShouldAllow("tenant", 5); allowed {
+		t.Fatalf("ShouldAllow() was allowed again after another key was peeked at")
+	}
+
+	attributeLimiter.SetPolicyResolver(nil)
+	if _, err := attributeLimiter.Peek("probe", 1); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("Peek() returned %v for non-existing key without a resolver, expected %v", err, ErrKeyNotFound)
+	}
+}
@@ -0,0 +1,93 @@
+package ratelimiter
+
+import (
+	"sync"
+	"time"
+)
+
+// reserver is implemented by limiters that hand out reservations.
+type reserver interface {
+	cancelReservation(r *Reservation)
+}
+
+// reservationQueue holds the times to act of outstanding reservations, in the order
+// they were made. New reservations are always booked after the last outstanding one.
+type reservationQueue []time.Time
+
+// from returns the earliest time a new reservation can be booked at, pruning the
+// reservations that are already due.
+func (q *reservationQueue) from(now time.Time) time.Time {
+	for len(*q) > 0 && !(*q)[0].After(now) {
+		*q = (*q)[1:]
+	}
+
+	if len(*q) == 0 {
+		return now
+	}
+
+	return (*q)[len(*q)-1]
+}
+
+func (q *reservationQueue) push(timeToAct time.Time) {
+	*q = append(*q, timeToAct)
+}
+
+func (q *reservationQueue) remove(timeToAct time.Time) {
+	for idx, t := range *q {
+		if t.Equal(timeToAct) {
+			*q = append((*q)[:idx], (*q)[idx+1:]...)
+			return
+		}
+	}
+}
+
+// Reservation holds the capacity booked by Reserve for n tasks at a point of time in future.
+type Reservation struct {
+	ok        bool
+	n         uint64
+	seq       uint64
+	timeToAct time.Time
+	limiter   reserver
+	clock     Clock
+	cancelled bool
+	lock      sync.Mutex
+}
+
+// OK returns whether the limiter was able to book the capacity. The reservation
+// is not valid if OK returns false, Delay and Cancel have no meaning in that case.
+func (r *Reservation) OK() bool {
+	return r.ok
+}
+
+// Delay returns the duration to wait before the reserved tasks can be processed.
+// Zero means the tasks can be processed right away.
+func (r *Reservation) Delay() time.Duration {
+	if !r.ok {
+		return 0
+	}
+
+	delay := r.timeToAct.Sub(r.clock.Now())
+	if delay < 0 {
+		return 0
+	}
+
+	return delay
+}
+
+// Cancel gives the reserved capacity back to the limiter, so it can be used by other tasks.
+// Calling Cancel after the delay has passed, i.e the tasks are assumed to be processed, has no effect.
+func (r *Reservation) Cancel() {
+	if !r.ok {
+		return
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.cancelled {
+		return
+	}
+
+	r.cancelled = true
+	r.limiter.cancelReservation(r)
+}
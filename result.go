@@ -0,0 +1,44 @@
+package ratelimiter
+
+import (
+	"time"
+)
+
+// Result describes the decision made by a limiter along with the state of the limiter after it,
+// it can be used to fill headers like Retry-After or X-RateLimit-Remaining.
+type Result struct {
+	// Allowed is true if the tasks were allowed and counted.
+	Allowed bool
+	// Limit is the number of tasks allowed per window.
+	Limit uint64
+	// Remaining is the number of tasks that can still be allowed right now.
+	Remaining uint64
+	// ResetAt is the end of the current window.
+	ResetAt time.Time
+	// RetryAfter is the duration to wait before the tasks can be allowed, it is zero
+	// if the tasks were allowed or if they can never be allowed (i.e n > Limit).
+	RetryAfter time.Duration
+}
+
+// windowResult builds the Result of a sliding window decision made at now.
+func windowResult(
+	previous, current *Window, reserved []uint64,
+	now time.Time, size time.Duration, limit, n uint64, allowed bool,
+) Result {
+	result := Result{
+		Allowed: allowed,
+		Limit:   limit,
+		ResetAt: current.getStartTime().Add(size),
+	}
+
+	if used := slidingCount(previous, current, now, size); used < limit {
+		result.Remaining = limit - used
+	}
+
+	if !allowed && n <= limit {
+		_, allowedAt := nextSlot(previous, current, reserved, now, size, limit, n)
+		result.RetryAfter = allowedAt.Sub(now)
+	}
+
+	return result
+}
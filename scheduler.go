@@ -0,0 +1,178 @@
+package ratelimiter
+
+import (
+	"container/heap"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// slideEntry is the time at which the windows of a DefaultLimiter have to be slided.
+type slideEntry struct {
+	at      time.Time
+	limiter *DefaultLimiter
+	index   int
+}
+
+// slideHeap is a min-heap of slideEntry ordered by time.
+type slideHeap []*slideEntry
+
+func (h slideHeap) Len() int           { return len(h) }
+func (h slideHeap) Less(i, j int) bool { return h[i].at.Before(h[j].at) }
+
+func (h slideHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *slideHeap) Push(x interface{}) {
+	entry := x.(*slideEntry)
+	entry.index = len(*h)
+	*h = append(*h, entry)
+}
+
+func (h *slideHeap) Pop() interface{} {
+	old := *h
+	entry := old[len(old)-1]
+	old[len(old)-1] = nil
+	entry.index = -1
+	*h = old[:len(old)-1]
+	return entry
+}
+
+// scheduler slides the windows of all the DefaultLimiters sharing a clock from a single
+// goroutine, which sleeps until the earliest slide is due and exits when there is nothing
+// left to slide.
+type scheduler struct {
+	clock   Clock
+	lock    sync.Mutex
+	entries slideHeap
+	wake    chan struct{}
+	running bool
+	shared  bool
+}
+
+var (
+	schedulersLock sync.Mutex
+	schedulers     = make(map[Clock]*scheduler)
+)
+
+// schedulerFor returns the scheduler shared by the limiters using the clock.
+func schedulerFor(clock Clock) *scheduler {
+	// clocks that can't be used as a map key get a scheduler of their own.
+	if !reflect.TypeOf(clock).Comparable() {
+		return newScheduler(clock)
+	}
+
+	schedulersLock.Lock()
+	defer schedulersLock.Unlock()
+
+	s, ok := schedulers[clock]
+	if !ok {
+		s = newScheduler(clock)
+		s.shared = true
+		schedulers[clock] = s
+	}
+
+	return s
+}
+
+func newScheduler(clock Clock) *scheduler {
+	return &scheduler{
+		clock: clock,
+		wake:  make(chan struct{}, 1),
+	}
+}
+
+// schedule the windows of the limiter to be slided at the given time, replacing the previous
+// schedule of the limiter if any. entry is the slideEntry of the limiter, owned by the scheduler.
+func (s *scheduler) schedule(entry *slideEntry, at time.Time) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	entry.at = at
+	if entry.index >= 0 {
+		heap.Fix(&s.entries, entry.index)
+	} else {
+		heap.Push(&s.entries, entry)
+	}
+
+	if !s.running {
+		s.running = true
+		go s.run()
+		return
+	}
+
+	// the goroutine might be sleeping until a later slide.
+	if entry.index == 0 {
+		select {
+		case s.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// remove the schedule of the limiter, if any.
+func (s *scheduler) remove(entry *slideEntry) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if entry.index >= 0 {
+		heap.Remove(&s.entries, entry.index)
+	}
+}
+
+// next pops the earliest entry if it is due, otherwise returns the duration until it is due.
+// It returns false once there is nothing left to slide, stopping the goroutine.
+func (s *scheduler) next() (*slideEntry, time.Duration, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if len(s.entries) == 0 {
+		s.running = false
+		return nil, 0, false
+	}
+
+	if wait := s.entries[0].at.Sub(s.clock.Now()); wait > 0 {
+		return nil, wait, true
+	}
+
+	return heap.Pop(&s.entries).(*slideEntry), 0, true
+}
+
+func (s *scheduler) run() {
+	for {
+		entry, wait, ok := s.next()
+		if !ok {
+			s.release()
+			return
+		}
+
+		if entry != nil {
+			entry.limiter.slide()
+			continue
+		}
+
+		timer := s.clock.NewTimer(wait)
+		select {
+		case <-timer.C():
+		case <-s.wake:
+			// an earlier slide was scheduled, re-compute the time to sleep.
+			timer.Stop()
+		}
+	}
+}
+
+// release forgets the scheduler once it is idle, so that the clock can be garbage collected.
+func (s *scheduler) release() {
+	schedulersLock.Lock()
+	defer schedulersLock.Unlock()
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.shared && !s.running && schedulers[s.clock] == s {
+		delete(schedulers, s.clock)
+	}
+}
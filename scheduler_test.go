@@ -0,0 +1,83 @@
+package ratelimiter
+
+import (
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestSchedulerSharedByLimiters(t *testing.T) {
+	clock := NewManualClock(time.Unix(1000, 0))
+	before := runtime.NumGoroutine()
+
+	limiters := make([]*DefaultLimiter, 100)
+	for idx := range limiters {
+		limiters[idx], _ = NewDefaultLimiter(10, time.Second, WithClock(clock))
+		limiters[idx].ShouldAllow(10)
+	}
+
+	if grown := runtime.NumGoroutine() - before; grown > 1 {
+		t.Fatalf("%d goroutines were started for %d limiters, expected at most 1", grown, len(limiters))
+	}
+
+	// every limiter is slided once the window is over:
+	clock.BlockUntil(1)
+	clock.Advance(time.Second)
+	clock.BlockUntil(1)
+	clock.Advance(time.Second)
+	clock.BlockUntil(1)
+
+	for idx, limiter := range limiters {
+		if allowed, _ := limiter.ShouldAllow(10); !allowed {
+			t.Fatalf("limiter %d did not slide it's windows", idx)
+		}
+	}
+
+	for _, limiter := range limiters {
+		limiter.Kill()
+	}
+
+	// the goroutine exits once there is nothing left to slide:
+	deadline := time.Now().Add(time.Second)
+	for {
+		schedulersLock.Lock()
+		_, ok := schedulers[Clock(clock)]
+		schedulersLock.Unlock()
+
+		if !ok {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("scheduler is still running after all the limiters were killed")
+		}
+
+		// wake the goroutine up, it is sleeping until the next slide.
+		clock.Advance(time.Second)
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestSchedulerSetSize(t *testing.T) {
+	clock := NewManualClock(time.Unix(1000, 0))
+	short, _ := NewDefaultLimiter(10, time.Second, WithClock(clock))
+	long, _ := NewDefaultLimiter(10, time.Hour, WithClock(clock))
+	defer short.Kill()
+	defer long.Kill()
+
+	long.ShouldAllow(10)
+	if err := long.SetSize(time.Second); err != nil {
+		t.Fatalf("SetSize() returned error %v", err)
+	}
+
+	// the resized limiter is slided along with the other limiter, not after an hour:
+	clock.BlockUntil(1)
+	clock.Advance(time.Second)
+	clock.BlockUntil(1)
+	clock.Advance(time.Second)
+	clock.BlockUntil(1)
+
+	if allowed, _ := long.ShouldAllow(10); !allowed {
+		t.Fatalf("limiter was not slided at the end of the resized window")
+	}
+}
@@ -0,0 +1,372 @@
+package ratelimiter
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// minLogCapacity is the initial capacity of the ring buffer of a SlidingLogLimiter.
+const minLogCapacity = 16
+
+// logEntry records the number of tasks allowed at a point of time.
+type logEntry struct {
+	timestamp int64
+	count     uint64
+}
+
+// SlidingLogLimiter enforces the limit exactly, by recording the timestamp of every allowed task
+// in a ring buffer. Unlike DefaultLimiter and SyncLimiter, it does not approximate the previous
+// window, so bursts can never exceed the limit at the window edges. The ring buffer grows up to
+// limit entries and is compacted as the entries expire.
+type SlidingLogLimiter struct {
+	lock     sync.Mutex
+	entries  []logEntry
+	head     int
+	length   int
+	total    uint64
+	limit    uint64
+	size     time.Duration
+	killed   bool
+	clock    Clock
+	notifier notifier
+}
+
+// at returns the entry at the given position, counting from the oldest entry.
+func (s *SlidingLogLimiter) at(idx int) *logEntry {
+	return &s.entries[(s.head+idx)%len(s.entries)]
+}
+
+// expire removes the entries that are out of the window ending at now and
+// shrinks the ring buffer if it is mostly empty.
+func (s *SlidingLogLimiter) expire(now int64) {
+	windowStart := now - int64(s.size)
+	for s.length > 0 {
+		oldest := s.at(0)
+		if oldest.timestamp > windowStart {
+			break
+		}
+
+		s.total -= oldest.count
+		s.head = (s.head + 1) % len(s.entries)
+		s.length--
+	}
+
+	if len(s.entries) > minLogCapacity && s.length < len(s.entries)/4 {
+		s.resize(len(s.entries) / 2)
+	}
+}
+
+// totalAt returns the number of tasks in the window ending at now, without expiring any entry.
+func (s *SlidingLogLimiter) totalAt(now int64) uint64 {
+	windowStart := now - int64(s.size)
+
+	total := s.total
+	for idx := 0; idx < s.length && s.at(idx).timestamp <= windowStart; idx++ {
+		total -= s.at(idx).count
+	}
+
+	return total
+}
+
+// record adds n tasks at now to the log, tasks at the same timestamp share an entry. Nothing
+// is recorded for 0 tasks, so that the log never holds more than limit entries.
+func (s *SlidingLogLimiter) record(now int64, n uint64) {
+	if n == 0 {
+		return
+	}
+
+	s.total += n
+
+	if s.length > 0 {
+		if newest := s.at(s.length - 1); newest.timestamp == now {
+			newest.count += n
+			return
+		}
+	}
+
+	if s.length == len(s.entries) {
+		// at most limit tasks are recorded, so the buffer never needs more than limit entries.
+		capacity := 2 * len(s.entries)
+		if uint64(capacity) > s.limit && uint64(s.length) < s.limit {
+			capacity = int(s.limit)
+		}
+		s.resize(capacity)
+	}
+
+	*s.at(s.length) = logEntry{timestamp: now, count: n}
+	s.length++
+}
+
+// resize copies the entries to a new ring buffer of given capacity.
+func (s *SlidingLogLimiter) resize(capacity int) {
+	if capacity < minLogCapacity {
+		capacity = minLogCapacity
+	}
+
+	entries := make([]logEntry, capacity)
+	for idx := 0; idx < s.length; idx++ {
+		entries[idx] = *s.at(idx)
+	}
+
+	s.entries = entries
+	s.head = 0
+}
+
+// retryAfter returns the duration after which n more tasks can be allowed, as the oldest entries expire.
+func (s *SlidingLogLimiter) retryAfter(now int64, n uint64) time.Duration {
+	total := s.total
+	for idx := 0; idx < s.length && total+n > s.limit; idx++ {
+		entry := s.at(idx)
+		total -= entry.count
+		if total+n <= s.limit {
+			return time.Duration(entry.timestamp + int64(s.size) - now)
+		}
+	}
+
+	return 0
+}
+
+func (s *SlidingLogLimiter) validate(fnName string) error {
+	if s.killed {
+		return fmt.Errorf("function %s called on an inactive instance: %w", fnName, ErrLimiterKilled)
+	}
+
+	if s.limit == 0 || s.size < time.Millisecond {
+		return ErrInvalidConfig
+	}
+
+	return nil
+}
+
+// ShouldAllow makes decison whether n tasks can be allowed or not.
+//
+// Parameters:
+//
+// 1. n: number of tasks to be processed, set this as 1 for a single task. (Example: An HTTP request)
+//
+// Returns (bool, error). (false, error) if limiter is inactive (or it is killed). Otherwise,
+// (true/false, nil) depending on whether n tasks can be allowed or not.
+func (s *SlidingLogLimiter) ShouldAllow(n uint64) (bool, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if err := s.validate("ShouldAllow"); err != nil {
+		return false, err
+	}
+
+	now := s.clock.Now().UnixNano()
+	s.expire(now)
+
+	allowed := s.total+n <= s.limit
+	if allowed {
+		s.record(now, n)
+	}
+
+	s.notifier.notify(n, allowed)
+	return allowed, nil
+}
+
+// Peek reports whether n tasks would be allowed right now, without counting them.
+//
+// Parameters:
+//
+// 1. n: number of tasks to be processed, set this as 1 for a single task. (Example: An HTTP request)
+//
+// Returns (bool, error). (false, error) if limiter is inactive (or it is killed). Otherwise,
+// (true/false, nil) depending on whether n tasks would be allowed or not.
+func (s *SlidingLogLimiter) Peek(n uint64) (bool, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if err := s.validate("Peek"); err != nil {
+		return false, err
+	}
+
+	return s.totalAt(s.clock.Now().UnixNano())+n <= s.limit, nil
+}
+
+// inspect describes the state of the limiter, all the tasks of the log are in the current window.
+func (s *SlidingLogLimiter) inspect() KeyInfo {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	total := s.totalAt(s.clock.Now().UnixNano())
+
+	return KeyInfo{
+		Limit:   s.limit,
+		Size:    s.size,
+		Current: total,
+		Usage:   total,
+	}
+}
+
+// Allow makes decison whether n tasks can be allowed or not, just like ShouldAllow,
+// and describes the state of the limiter after the decision. ResetAt is the time
+// at which all the recorded tasks will be out of the window.
+//
+// Parameters:
+//
+// 1. n: number of tasks to be processed, set this as 1 for a single task. (Example: An HTTP request)
+//
+// Returns (Result, error). (Result{}, error) if limiter is inactive (or it is killed). Otherwise,
+// (Result, nil) where Result.Allowed is true/false depending on whether n tasks can be allowed or not.
+func (s *SlidingLogLimiter) Allow(n uint64) (Result, error) {
+	return s.allowResult(n, true)
+}
+
+// allowResult is Allow, the observer is notified of the decision only if notify is true.
+func (s *SlidingLogLimiter) allowResult(n uint64, notify bool) (Result, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if err := s.validate("Allow"); err != nil {
+		return Result{}, err
+	}
+
+	currentTime := s.clock.Now()
+	now := currentTime.UnixNano()
+	s.expire(now)
+
+	allowed := s.total+n <= s.limit
+	if allowed {
+		s.record(now, n)
+	}
+
+	if notify {
+		s.notifier.notify(n, allowed)
+	}
+	result := Result{
+		Allowed: allowed,
+		Limit:   s.limit,
+		ResetAt: currentTime,
+	}
+
+	if s.total < s.limit {
+		result.Remaining = s.limit - s.total
+	}
+
+	if s.length > 0 {
+		result.ResetAt = time.Unix(0, s.at(s.length-1).timestamp).Add(s.size)
+	}
+
+	if !allowed && n <= s.limit {
+		result.RetryAfter = s.retryAfter(now, n)
+	}
+
+	return result, nil
+}
+
+// observer returns the notifier of the observer of the limiter.
+func (s *SlidingLogLimiter) observer() notifier {
+	return s.notifier
+}
+
+// SetLimit changes the number of tasks to be allowed per window, the recorded tasks are retained.
+//
+// Parameters:
+//
+// 1. limit: The number of tasks to be allowd
+//
+// Returns an error if the limiter is inactive (or it is killed) or limit is 0.
+func (s *SlidingLogLimiter) SetLimit(limit uint64) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.killed {
+		return fmt.Errorf("function SetLimit called on an inactive instance: %w", ErrLimiterKilled)
+	}
+
+	if limit == 0 {
+		return ErrInvalidConfig
+	}
+
+	s.limit = limit
+	return nil
+}
+
+// SetSize changes the window size, the recorded tasks are retained.
+//
+// Parameters:
+//
+// 1. size: duration
+//
+// Returns an error if the limiter is inactive (or it is killed) or size is less than a millisecond.
+func (s *SlidingLogLimiter) SetSize(size time.Duration) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.killed {
+		return fmt.Errorf("function SetSize called on an inactive instance: %w", ErrLimiterKilled)
+	}
+
+	if size < time.Millisecond {
+		return ErrInvalidConfig
+	}
+
+	s.size = size
+	return nil
+}
+
+// refund removes n tasks recorded by ShouldAllow or Allow moments ago, newest entries first.
+func (s *SlidingLogLimiter) refund(n uint64) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for n > 0 && s.length > 0 {
+		newest := s.at(s.length - 1)
+		if newest.count > n {
+			newest.count -= n
+			s.total -= n
+			return
+		}
+
+		n -= newest.count
+		s.total -= newest.count
+		s.length--
+	}
+}
+
+// Kill the limiter, returns error if the limiter has been killed already.
+func (s *SlidingLogLimiter) Kill() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.killed {
+		return fmt.Errorf("called Kill on already killed limiter: %w", ErrLimiterKilled)
+	}
+
+	s.killed = true
+	s.entries = nil
+	s.head, s.length, s.total = 0, 0, 0
+	return nil
+}
+
+// NewSlidingLogLimiter creates an instance of SlidingLogLimiter and returns it's pointer.
+//
+// Parameters:
+//
+// 1. limit: The number of tasks to be allowd
+//
+// 2. size: duration
+//
+// 3. opts: optional parameters, example: WithClock, WithName, WithObserver
+//
+// Returns an error if limit is 0 or size is less than a millisecond.
+func NewSlidingLogLimiter(limit uint64, size time.Duration, opts ...Option) (*SlidingLogLimiter, error) {
+	if limit == 0 || size < time.Millisecond {
+		return nil, ErrInvalidConfig
+	}
+
+	o := newOptions(opts)
+
+	return &SlidingLogLimiter{
+		lock:     sync.Mutex{},
+		entries:  make([]logEntry, minLogCapacity),
+		limit:    limit,
+		size:     size,
+		killed:   false,
+		clock:    o.clock,
+		notifier: o.notifier(),
+	}, nil
+}
@@ -0,0 +1,114 @@
+package ratelimiter
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSlidingLogLimiter(t *testing.T) {
+	clock := NewManualClock(time.Unix(1000, 0))
+	limiter, _ := NewSlidingLogLimiter(10, time.Second, WithClock(clock))
+
+	check := func(n uint64, expected bool) {
+		allowed, err := limiter.ShouldAllow(n)
+		if err != nil {
+			t.Fatalf("Error when calling ShouldAllow() on active limiter, Error: %v", err)
+		}
+		if allowed != expected {
+			t.Fatalf("ShouldAllow(%d) returned %v, expected %v", n, allowed, expected)
+		}
+	}
+
+	check(5, true)
+	clock.Advance(900 * time.Millisecond)
+	check(5, true)
+	check(1, false)
+
+	// a sliding window would allow a burst at the window edge, the log does not:
+	clock.Advance(100 * time.Millisecond)
+	check(6, false)
+	check(5, true)
+
+	result, err := limiter.Allow(3)
+	if err != nil {
+		t.Fatalf("Error when calling Allow() on active limiter, Error: %v", err)
+	}
+
+	if result.Allowed || result.Remaining != 0 || result.RetryAfter != 900*time.Millisecond {
+		t.Fatalf("Allow() returned unexpected result %+v", result)
+	}
+
+	if !result.ResetAt.Equal(clock.Now().Add(time.Second)) {
+		t.Fatalf("Allow() returned reset time %v, expected %v", result.ResetAt, clock.Now().Add(time.Second))
+	}
+
+	clock.Advance(900 * time.Millisecond)
+	check(3, true)
+
+	limiter.Kill()
+	if _, err := limiter.ShouldAllow(1); err == nil {
+		t.Fatalf("Calling ShouldAllow() on inactive limiter did not throw any errors.")
+	}
+}
+
+func TestSlidingLogCompaction(t *testing.T) {
+	clock := NewManualClock(time.Unix(1000, 0))
+	limiter, _ := NewSlidingLogLimiter(1000, time.Second, WithClock(clock))
+
+	for i := 0; i < 1000; i++ {
+		if allowed, _ := limiter.ShouldAllow(1); !allowed {
+			t.Fatalf("ShouldAllow() failed to allow tasks within the limit")
+		}
+		clock.Advance(time.Microsecond)
+	}
+
+	if len(limiter.entries) > 1000 {
+		t.Fatalf("ring buffer grew to %d entries, beyond the limit", len(limiter.entries))
+	}
+
+	// all the entries expire and the buffer is compacted:
+	for i := 0; i < 10; i++ {
+		clock.Advance(time.Second)
+		limiter.ShouldAllow(1)
+	}
+
+	if len(limiter.entries) != minLogCapacity || limiter.length != 1 {
+		t.Fatalf("ring buffer was not compacted, %d entries with capacity %d", limiter.length, len(limiter.entries))
+	}
+
+	// no entry is recorded for 0 tasks:
+	limiter, _ = NewSlidingLogLimiter(2, time.Second, WithClock(clock))
+	for i := 0; i < 10000; i++ {
+		limiter.ShouldAllow(0)
+		limiter.Allow(0)
+		clock.Advance(time.Microsecond)
+	}
+
+	if limiter.length != 0 || len(limiter.entries) > minLogCapacity {
+		t.Fatalf("ring buffer holds %d entries with capacity %d after 0 tasks were allowed", limiter.length, len(limiter.entries))
+	}
+}
+
+func TestAttributeBasedSlidingLog(t *testing.T) {
+	attributeLimiter := NewAttributeBasedLimiter(false, WithLimiterType(SlidingLog))
+
+	if !attributeLimiter.MustShouldAllow("key", 10, 10, time.Second) {
+		t.Fatalf("AttributeBasedLimiter.MustShouldAllow() failed to allow tasks within the limit")
+	}
+
+	limiter, _ := attributeLimiter.getLimiter("key")
+	if _, ok := limiter.(*SlidingLogLimiter); !ok {
+		t.Fatalf("AttributeBasedLimiter did not create a SlidingLogLimiter for the key")
+	}
+}
+
+func BenchmarkSlidingLogLimiter(b *testing.B) {
+	limiter, _ := NewSlidingLogLimiter(100, 1*time.Second)
+
+	for i := 0; i < b.N; i++ {
+		_, err := limiter.ShouldAllow(1)
+		if err != nil {
+			b.Fatalf("Error when calling ShouldAllow() on active limiter, Error: %v", err)
+		}
+	}
+}
@@ -0,0 +1,295 @@
+package ratelimiter
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// TokenBucketLimiter implements the token bucket rate limiting algorithm, limit tokens are
+// added to the bucket every window of given size and the bucket holds at most burst tokens.
+// Each task consumes a token, bursts of up to burst tasks are allowed at once.
+type TokenBucketLimiter struct {
+	lock  sync.Mutex
+	limit uint64
+	size  time.Duration
+	burst uint64
+	// burstIsLimit is true when the burst was not set by WithBurst, it then follows the limit.
+	burstIsLimit bool
+	tokens       float64
+	lastRefill   time.Time
+	killed       bool
+	clock        Clock
+	notifier     notifier
+}
+
+// tokensAt returns the tokens the bucket would hold at now, must be called with lock held.
+func (t *TokenBucketLimiter) tokensAt(now time.Time) float64 {
+	elapsed := now.Sub(t.lastRefill)
+	if elapsed <= 0 {
+		return t.tokens
+	}
+
+	return math.Min(
+		float64(t.burst),
+		t.tokens+float64(elapsed)*float64(t.limit)/float64(t.size),
+	)
+}
+
+// refill adds the tokens accumulated since the last refill, must be called with lock held.
+func (t *TokenBucketLimiter) refill(now time.Time) {
+	if now.After(t.lastRefill) {
+		t.tokens = t.tokensAt(now)
+		t.lastRefill = now
+	}
+}
+
+// timeToFill returns the duration after which the bucket holds n tokens.
+func (t *TokenBucketLimiter) timeToFill(n float64) time.Duration {
+	if t.tokens >= n {
+		return 0
+	}
+
+	return time.Duration(math.Ceil((n - t.tokens) * float64(t.size) / float64(t.limit)))
+}
+
+func (t *TokenBucketLimiter) validate(fnName string) error {
+	if t.killed {
+		return fmt.Errorf("function %s called on an inactive instance: %w", fnName, ErrLimiterKilled)
+	}
+
+	if t.limit == 0 || t.burst == 0 || t.size < time.Millisecond {
+		return ErrInvalidConfig
+	}
+
+	return nil
+}
+
+// ShouldAllow makes decison whether n tasks can be allowed or not.
+//
+// Parameters:
+//
+// 1. n: number of tasks to be processed, set this as 1 for a single task. (Example: An HTTP request)
+//
+// Returns (bool, error). (false, error) if limiter is inactive (or it is killed). Otherwise,
+// (true/false, nil) depending on whether n tasks can be allowed or not.
+func (t *TokenBucketLimiter) ShouldAllow(n uint64) (bool, error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if err := t.validate("ShouldAllow"); err != nil {
+		return false, err
+	}
+
+	t.refill(t.clock.Now())
+
+	allowed := t.tokens >= float64(n)
+	if allowed {
+		t.tokens -= float64(n)
+	}
+
+	t.notifier.notify(n, allowed)
+	return allowed, nil
+}
+
+// Peek reports whether n tasks would be allowed right now, without counting them.
+//
+// Parameters:
+//
+// 1. n: number of tasks to be processed, set this as 1 for a single task. (Example: An HTTP request)
+//
+// Returns (bool, error). (false, error) if limiter is inactive (or it is killed). Otherwise,
+// (true/false, nil) depending on whether n tasks would be allowed or not.
+func (t *TokenBucketLimiter) Peek(n uint64) (bool, error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if err := t.validate("Peek"); err != nil {
+		return false, err
+	}
+
+	return t.tokensAt(t.clock.Now()) >= float64(n), nil
+}
+
+// inspect describes the state of the limiter, the usage is the number of tokens missing from the bucket.
+func (t *TokenBucketLimiter) inspect() KeyInfo {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	return KeyInfo{
+		Limit: t.limit,
+		Size:  t.size,
+		Usage: uint64(math.Ceil(float64(t.burst) - t.tokensAt(t.clock.Now()))),
+	}
+}
+
+// Allow makes decison whether n tasks can be allowed or not, just like ShouldAllow,
+// and describes the state of the limiter after the decision. Limit is the burst
+// and ResetAt is the time at which the bucket will be full again.
+//
+// Parameters:
+//
+// 1. n: number of tasks to be processed, set this as 1 for a single task. (Example: An HTTP request)
+//
+// Returns (Result, error). (Result{}, error) if limiter is inactive (or it is killed). Otherwise,
+// (Result, nil) where Result.Allowed is true/false depending on whether n tasks can be allowed or not.
+func (t *TokenBucketLimiter) Allow(n uint64) (Result, error) {
+	return t.allowResult(n, true)
+}
+
+// allowResult is Allow, the observer is notified of the decision only if notify is true.
+func (t *TokenBucketLimiter) allowResult(n uint64, notify bool) (Result, error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if err := t.validate("Allow"); err != nil {
+		return Result{}, err
+	}
+
+	currentTime := t.clock.Now()
+	t.refill(currentTime)
+
+	allowed := t.tokens >= float64(n)
+	if allowed {
+		t.tokens -= float64(n)
+	}
+
+	if notify {
+		t.notifier.notify(n, allowed)
+	}
+	result := Result{
+		Allowed:   allowed,
+		Limit:     t.burst,
+		Remaining: uint64(t.tokens),
+		ResetAt:   currentTime.Add(t.timeToFill(float64(t.burst))),
+	}
+
+	if !allowed && n <= t.burst {
+		result.RetryAfter = t.timeToFill(float64(n))
+	}
+
+	return result, nil
+}
+
+// observer returns the notifier of the observer of the limiter.
+func (t *TokenBucketLimiter) observer() notifier {
+	return t.notifier
+}
+
+// SetLimit changes the number of tokens added to the bucket every window.
+//
+// Parameters:
+//
+// 1. limit: The number of tokens to be added per window.
+//
+// Returns an error if the limiter is inactive (or it is killed) or limit is 0. The burst is
+// changed along with the limit unless it was set using WithBurst.
+func (t *TokenBucketLimiter) SetLimit(limit uint64) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.killed {
+		return fmt.Errorf("function SetLimit called on an inactive instance: %w", ErrLimiterKilled)
+	}
+
+	if limit == 0 {
+		return ErrInvalidConfig
+	}
+
+	// tokens accumulated so far are computed with the old rate.
+	t.refill(t.clock.Now())
+	t.limit = limit
+
+	if t.burstIsLimit {
+		t.burst = limit
+		t.tokens = math.Min(float64(t.burst), t.tokens)
+	}
+
+	return nil
+}
+
+// SetSize changes the window size, i.e the interval in which limit tokens are added.
+//
+// Parameters:
+//
+// 1. size: duration
+//
+// Returns an error if the limiter is inactive (or it is killed) or size is less than a millisecond.
+func (t *TokenBucketLimiter) SetSize(size time.Duration) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.killed {
+		return fmt.Errorf("function SetSize called on an inactive instance: %w", ErrLimiterKilled)
+	}
+
+	if size < time.Millisecond {
+		return ErrInvalidConfig
+	}
+
+	t.refill(t.clock.Now())
+	t.size = size
+	return nil
+}
+
+// refund puts back n tokens consumed by ShouldAllow or Allow moments ago.
+func (t *TokenBucketLimiter) refund(n uint64) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.tokens = math.Min(float64(t.burst), t.tokens+float64(n))
+}
+
+// Kill the limiter, returns error if the limiter has been killed already.
+func (t *TokenBucketLimiter) Kill() error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.killed {
+		return fmt.Errorf("called Kill on already killed limiter: %w", ErrLimiterKilled)
+	}
+
+	t.killed = true
+	return nil
+}
+
+// NewTokenBucketLimiter creates an instance of TokenBucketLimiter and returns it's pointer.
+// The bucket is full when created, it holds at most limit tokens unless WithBurst is used.
+//
+// Parameters:
+//
+// 1. limit: The number of tokens added to the bucket per window, i.e the rate.
+//
+// 2. size: duration
+//
+// 3. opts: optional parameters, example: WithBurst, WithClock, WithName, WithObserver
+//
+// Returns an error if limit or burst is 0 or size is less than a millisecond.
+func NewTokenBucketLimiter(limit uint64, size time.Duration, opts ...Option) (*TokenBucketLimiter, error) {
+	o := newOptions(opts)
+
+	burst := o.burst
+	if burst == 0 {
+		burst = limit
+	}
+
+	limiter := &TokenBucketLimiter{
+		lock:         sync.Mutex{},
+		limit:        limit,
+		size:         size,
+		burst:        burst,
+		burstIsLimit: o.burst == 0,
+		tokens:       float64(burst),
+		lastRefill:   o.clock.Now(),
+		killed:       false,
+		clock:        o.clock,
+		notifier:     o.notifier(),
+	}
+
+	if err := limiter.validate("NewTokenBucketLimiter"); err != nil {
+		return nil, err
+	}
+
+	return limiter, nil
+}
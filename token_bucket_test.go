@@ -0,0 +1,141 @@
+package ratelimiter
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTokenBucketLimiter(t *testing.T) {
+	clock := NewManualClock(time.Unix(1000, 0))
+
+	// 10 tasks per second with bursts of up to 20 tasks.
+	limiter, _ := NewTokenBucketLimiter(10, time.Second, WithBurst(20), WithClock(clock))
+
+	check := func(n uint64, expected bool) {
+		allowed, err := limiter.ShouldAllow(n)
+		if err != nil {
+			t.Fatalf("Error when calling ShouldAllow() on active limiter, Error: %v", err)
+		}
+		if allowed != expected {
+			t.Fatalf("ShouldAllow(%d) returned %v, expected %v", n, allowed, expected)
+		}
+	}
+
+	// the bucket is full when created:
+	check(20, true)
+	check(1, false)
+
+	// 5 tokens are added in half a second:
+	clock.Advance(500 * time.Millisecond)
+	check(5, true)
+	check(1, false)
+
+	// the bucket never holds more than burst tokens:
+	clock.Advance(time.Hour)
+	check(21, false)
+
+	result, err := limiter.Allow(20)
+	if err != nil {
+		t.Fatalf("Error when calling Allow() on active limiter, Error: %v", err)
+	}
+
+	if !result.Allowed || result.Remaining != 0 || !result.ResetAt.Equal(clock.Now().Add(2*time.Second)) {
+		t.Fatalf("Allow() returned unexpected result %+v", result)
+	}
+
+	result, _ = limiter.Allow(5)
+	if result.Allowed || result.RetryAfter != 500*time.Millisecond {
+		t.Fatalf("Allow() returned unexpected result %+v", result)
+	}
+
+	if err := limiter.Kill(); err != nil {
+		t.Fatalf("Failed to kill an active limiter, Error: %v", err)
+	}
+
+	if err := limiter.Kill(); err == nil {
+		t.Fatalf("Failed to throw error when Kill() was called on the same limiter twice.")
+	}
+
+	if _, err := limiter.ShouldAllow(1); err == nil {
+		t.Fatalf("Calling ShouldAllow() on inactive limiter did not throw any errors.")
+	}
+}
+
+func TestTokenBucketInvalidConfiguration(t *testing.T) {
+	if _, err := NewTokenBucketLimiter(0, time.Second); err == nil {
+		t.Fatalf("NewTokenBucketLimiter() failed, did not throw error when limit == 0")
+	}
+
+	if _, err := NewTokenBucketLimiter(10, time.Microsecond); err == nil {
+		t.Fatalf("NewTokenBucketLimiter() failed, did not throw error when window size <= 1 millisecond")
+	}
+}
+
+func TestTokenBucketSetLimit(t *testing.T) {
+	clock := NewManualClock(time.Unix(1000, 0))
+
+	// the burst follows the limit unless it was set using WithBurst:
+	limiter, _ := NewTokenBucketLimiter(10, time.Second, WithClock(clock))
+	limiter.SetLimit(20)
+	clock.Advance(time.Second)
+
+	if result, _ := limiter.Allow(20); !result.Allowed || result.Limit != 20 {
+		t.Fatalf("Allow(20) returned %+v after the limit was raised to 20", result)
+	}
+
+	limiter.SetLimit(5)
+	clock.Advance(time.Second)
+	if allowed, _ := limiter.ShouldAllow(6); allowed {
+		t.Fatalf("ShouldAllow(6) was allowed after the limit was lowered to 5")
+	}
+
+	limiter, _ = NewTokenBucketLimiter(10, time.Second, WithBurst(3), WithClock(clock))
+	limiter.SetLimit(20)
+	if result, _ := limiter.Allow(1); result.Limit != 3 {
+		t.Fatalf("Allow() returned burst %d after the limit was changed, expected 3", result.Limit)
+	}
+
+	// keys following a policy are rescaled along with it:
+	attributeLimiter := NewAttributeBasedLimiter(false, WithClock(clock), WithLimiterType(TokenBucket))
+	attributeLimiter.SetPolicy(Policy{Name: "free", Limit: 10, Size: time.Second})
+	attributeLimiter.CreateKeyWithPolicy("key", "free")
+	attributeLimiter.SetPolicy(Policy{Name: "free", Limit: 50, Size: time.Second})
+
+	if result, _ := attributeLimiter.Allow("key", 1); result.Limit != 50 {
+		t.Fatalf("Allow() returned limit %d after the policy was changed, expected 50", result.Limit)
+	}
+}
+
+func TestAttributeBasedTokenBucket(t *testing.T) {
+	clock := NewManualClock(time.Unix(1000, 0))
+	attributeLimiter := NewAttributeBasedLimiter(false, WithClock(clock), WithLimiterType(TokenBucket))
+
+	if !attributeLimiter.MustShouldAllow("key", 10, 10, time.Second) {
+		t.Fatalf("AttributeBasedLimiter.MustShouldAllow() failed to allow tasks within the burst")
+	}
+
+	limiter, _ := attributeLimiter.getLimiter("key")
+	if _, ok := limiter.(*TokenBucketLimiter); !ok {
+		t.Fatalf("AttributeBasedLimiter did not create a TokenBucketLimiter for the key")
+	}
+
+	if allowed, _ := attributeLimiter.ShouldAllow("key", 1); allowed {
+		t.Fatalf("AttributeBasedLimiter.ShouldAllow() allowed tasks beyond the burst")
+	}
+
+	clock.Advance(100 * time.Millisecond)
+	if allowed, _ := attributeLimiter.ShouldAllow("key", 1); !allowed {
+		t.Fatalf("AttributeBasedLimiter.ShouldAllow() did not allow tasks after the bucket was refilled")
+	}
+}
+
+func BenchmarkTokenBucketLimiter(b *testing.B) {
+	limiter, _ := NewTokenBucketLimiter(100, 1*time.Second)
+
+	for i := 0; i < b.N; i++ {
+		_, err := limiter.ShouldAllow(1)
+		if err != nil {
+			b.Fatalf("Error when calling ShouldAllow() on active limiter, Error: %v", err)
+		}
+	}
+}
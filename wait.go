@@ -0,0 +1,96 @@
+package ratelimiter
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// minWaitDelay is the least duration a waiter sleeps before retrying, this avoids spinning
+// when the estimated wait time is rounded down to zero.
+const minWaitDelay = 100 * time.Microsecond
+
+// waitTicket represents a single goroutine waiting in a waitQueue.
+type waitTicket struct {
+	ready chan struct{}
+}
+
+// waitQueue serves waiting goroutines in FIFO order, only the goroutine at the head
+// of the queue is allowed to consume from the limiter.
+type waitQueue struct {
+	lock    sync.Mutex
+	tickets []*waitTicket
+}
+
+// join adds a new ticket to the tail of the queue, the ready channel of the ticket
+// is closed once it reaches the head of the queue.
+func (q *waitQueue) join() *waitTicket {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	ticket := &waitTicket{ready: make(chan struct{})}
+	q.tickets = append(q.tickets, ticket)
+	if len(q.tickets) == 1 {
+		close(ticket.ready)
+	}
+
+	return ticket
+}
+
+// leave removes the ticket from the queue and hands over the head to the next ticket.
+func (q *waitQueue) leave(ticket *waitTicket) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	for idx, t := range q.tickets {
+		if t != ticket {
+			continue
+		}
+
+		q.tickets = append(q.tickets[:idx], q.tickets[idx+1:]...)
+		if idx == 0 && len(q.tickets) > 0 {
+			close(q.tickets[0].ready)
+		}
+		return
+	}
+}
+
+// wait blocks until tryAllow admits the tasks or ctx is done. tryAllow must atomically
+// check and count the tasks, returning the duration to wait before retrying otherwise.
+func (q *waitQueue) wait(ctx context.Context, clock Clock, tryAllow func() (bool, time.Duration, error)) error {
+	ticket := q.join()
+	defer q.leave(ticket)
+
+	select {
+	case <-ticket.ready:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		allowed, delay, err := tryAllow()
+		if err != nil {
+			return err
+		}
+
+		if allowed {
+			return nil
+		}
+
+		if delay < minWaitDelay {
+			delay = minWaitDelay
+		}
+
+		timer := clock.NewTimer(delay)
+		select {
+		case <-timer.C():
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+}
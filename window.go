@@ -1,6 +1,7 @@
 package ratelimiter
 
 import (
+	"math"
 	"time"
 )
 
@@ -33,6 +34,185 @@ func (w *Window) setToState(startTime time.Time, count uint64) {
 	w.count = count
 }
 
+// scaleCount rescales a window count by ratio, rounding up so that rescaling never
+// gives away more capacity than what was used.
+func scaleCount(count uint64, ratio float64) uint64 {
+	return uint64(math.Ceil(float64(count) * ratio))
+}
+
+// rescale the counts of the windows when the window size changes from oldSize to newSize,
+// so that the rate observed by the windows is preserved.
+func rescale(previous, current *Window, reserved []uint64, oldSize, newSize time.Duration) {
+	ratio := float64(newSize) / float64(oldSize)
+
+	previous.count = scaleCount(previous.count, ratio)
+	current.count = scaleCount(current.count, ratio)
+	for idx := range reserved {
+		reserved[idx] = scaleCount(reserved[idx], ratio)
+	}
+}
+
+// slidingCount returns the approximate number of tasks counted in the sliding window
+// of given size ending at now, the previous window is weighted by its overlap. The overlap
+// is clamped, as now can be past the end of the current window when the slide is late.
+func slidingCount(previous, current *Window, now time.Time, size time.Duration) uint64 {
+	currentWindowBoundary := now.Sub(current.getStartTime())
+
+	w := math.Max(0, math.Min(1, float64(size-currentWindowBoundary)/float64(size)))
+
+	return uint64(w*float64(previous.count)) + current.count
+}
+
+// debt returns the number of tasks counted beyond the limit in the sliding window ending at now.
+func debt(previous, current *Window, now time.Time, size time.Duration, limit uint64) uint64 {
+	if used := slidingCount(previous, current, now, size); used > limit {
+		return used - limit
+	}
+
+	return 0
+}
+
+// reservedCount returns the count of the window that is j windows after current,
+// reserved holds the counts booked for the windows following the current one.
+func reservedCount(current *Window, reserved []uint64, j int64) uint64 {
+	if j == 0 {
+		return current.count
+	}
+
+	if j-1 < int64(len(reserved)) {
+		return reserved[j-1]
+	}
+
+	return 0
+}
+
+// admits reports whether n tasks can be counted in the current window at now. Tasks counted
+// now also weigh on the next window, so the counts booked for it are taken into account.
+func admits(previous, current *Window, reserved []uint64, now time.Time, size time.Duration, limit, n uint64) bool {
+	if slidingCount(previous, current, now, size)+n > limit {
+		return false
+	}
+
+	return len(reserved) == 0 || current.count+n+reserved[0] <= limit
+}
+
+// nextSlot returns the earliest time, not before from, at which n tasks can be counted without
+// exceeding the limit, along with the index of the window containing it (0 for the current window).
+// reserved holds the counts booked for the windows following the current one, n must not be
+// greater than limit.
+func nextSlot(
+	previous, current *Window, reserved []uint64,
+	from time.Time, size time.Duration, limit, n uint64,
+) (int64, time.Time) {
+	previousCount := previous.count
+
+	for j := int64(0); ; j++ {
+		if j > 0 {
+			previousCount = reservedCount(current, reserved, j-1)
+		}
+		currentCount := reservedCount(current, reserved, j)
+
+		windowStart := current.getStartTime().Add(time.Duration(j) * size)
+		if j > int64(len(reserved)) && previousCount == 0 {
+			// nothing is counted from this window onwards.
+			if from.Before(windowStart) {
+				return j, windowStart
+			}
+			return j + int64(from.Sub(windowStart)/size), from
+		}
+
+		elapsed := from.Sub(windowStart)
+		if elapsed < 0 {
+			elapsed = 0
+		}
+
+		if elapsed >= size || currentCount+n > limit {
+			continue
+		}
+
+		// solve (1 - elapsed/size) * previousCount <= limit - n - currentCount for elapsed.
+		var allowedAt time.Duration
+		if previousCount > 0 {
+			fraction := float64(limit-n-currentCount) / float64(previousCount)
+			if fraction < 1 {
+				allowedAt = time.Duration(math.Ceil((1 - fraction) * float64(size)))
+			}
+		}
+
+		if allowedAt < elapsed {
+			allowedAt = elapsed
+		}
+
+		if allowedAt < size {
+			return j, windowStart.Add(allowedAt)
+		}
+	}
+}
+
+// book counts n tasks in the window that is j windows after current and returns the updated
+// reserved counts. Windows beyond the reserved ones hold no counts, so such bookings are
+// placed in the first window following the reserved ones.
+func book(current *Window, reserved []uint64, j int64, n uint64) []uint64 {
+	if j == 0 {
+		current.updateCount(n)
+		return reserved
+	}
+
+	if j > int64(len(reserved)) {
+		reserved = append(reserved, 0)
+		j = int64(len(reserved))
+	}
+
+	reserved[j-1] += n
+	return reserved
+}
+
+// unbook removes n tasks from the window that is j windows after current, never going below zero,
+// and returns the updated reserved counts.
+func unbook(current *Window, reserved []uint64, j int64, n uint64) []uint64 {
+	if j == 0 {
+		if n > current.count {
+			n = current.count
+		}
+		current.count -= n
+		return reserved
+	}
+
+	if j > int64(len(reserved)) {
+		return reserved
+	}
+
+	if n > reserved[j-1] {
+		n = reserved[j-1]
+	}
+	reserved[j-1] -= n
+
+	// drop the trailing windows that no longer hold any booking.
+	for len(reserved) > 0 && reserved[len(reserved)-1] == 0 {
+		reserved = reserved[:len(reserved)-1]
+	}
+
+	return reserved
+}
+
+// uncount removes n tasks from the window they were counted in at chargedAt, nothing is removed
+// if that window has slid out. The count never goes below zero.
+func uncount(previous, current *Window, n uint64, chargedAt time.Time) {
+	window := current
+	if chargedAt.Before(current.getStartTime()) {
+		if chargedAt.Before(previous.getStartTime()) {
+			return
+		}
+		window = previous
+	}
+
+	if window.count < n {
+		n = window.count
+	}
+
+	window.count -= n
+}
+
 // Creates and returns a pointer to the new Window instance.
 //
 // Parameters: